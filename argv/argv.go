@@ -8,12 +8,17 @@ import (
 
 // Argv represents a parsed argument with main name
 // a list of ops with a `--` prefix and pairs of key
-// values.
+// values, where the values of repeated flags accumulate
+// in order. The trailing arguments of Text are kept as
+// is in Args and all arguments after a `--` terminator
+// are left unparsed in Remainder.
 type Argv struct {
-	Name  string
-	Sub   *Argv
-	Text  string
-	Pairs map[string][]string
+	Name      string
+	Sub       *Argv
+	Text      string
+	Args      []string
+	Remainder []string
+	Pairs     map[string][]string
 }
 
 // New returns a new instance of Argv.
@@ -36,25 +41,161 @@ func (a *Argv) IsArg() bool {
 	return false
 }
 
+// Flatten returns a copy of the argument where the names of all sub
+// arguments are treated as positional arguments in Args, with their
+// pairs merged into Pairs, for when the trailing text of the argument
+// does not name a sub command. Pairs set earlier take precedence.
+func (a *Argv) Flatten() Argv {
+	flat := Argv{
+		Name:      a.Name,
+		Remainder: a.Remainder,
+		Pairs:     map[string][]string{},
+	}
+
+	for key, values := range a.Pairs {
+		flat.Pairs[key] = values
+	}
+
+	sub := a.Sub
+	if sub == nil {
+		flat.Text = a.Text
+		flat.Args = a.Args
+		return flat
+	}
+
+	for ; sub != nil; sub = sub.Sub {
+		if sub.Name != "" {
+			flat.Args = append(flat.Args, sub.Name)
+		}
+		for key, values := range sub.Pairs {
+			if _, ok := flat.Pairs[key]; !ok {
+				flat.Pairs[key] = values
+			}
+		}
+		if sub.Sub == nil && sub.Text != "" {
+			flat.Args = append(flat.Args, sub.Args...)
+		}
+		if len(sub.Remainder) != 0 && len(flat.Remainder) == 0 {
+			flat.Remainder = sub.Remainder
+		}
+	}
+
+	flat.Text = strings.Join(flat.Args, " ")
+	return flat
+}
+
 // Parse takes provided string, splits according to space
-// and parses arguments.
+// and parses arguments. Single and double quotes group text
+// with spaces into one argument, as in `--msg="hello world"`,
+// and a backslash escapes the following character.
 func Parse(args string) (Argv, error) {
 	if len(args) == 0 {
 		return Argv{}, errors.New("no argument provided")
 	}
-	return parseArgs(strings.Split(args, " "))
+	items, err := tokenize(args, false)
+	if err != nil {
+		return Argv{}, err
+	}
+	return parseArgs(items, nil, nil)
 }
 
-// parseArgs attempts to parse the slice of strings
-// as a instance of Argv returning an error if one exists.
-func parseArgs(args []string) (Argv, error) {
+// Join returns giving arguments as a string which Parse splits back
+// into the same arguments, quoting those with spaces, quotes or
+// backslashes.
+func Join(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n\r'\"\\") {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// ValueFunc defines a function type which reports if the flag of giving
+// name, provided to the command at giving path of command names, takes
+// the following argument as its value when provided without `=`.
+type ValueFunc func(path []string, flag string) bool
+
+// ParseWithValues behaves like Parse, but flags for which takesValue
+// returns true receive the following argument as their value when
+// provided without `=`, as in `--name wallet`, unless that argument is
+// a flag, a list or the `--` terminator. An empty argument, as in
+// `--name ""`, is kept as an empty value. Other flags without `=` are
+// set to "true".
+func ParseWithValues(args string, takesValue ValueFunc) (Argv, error) {
+	if len(args) == 0 {
+		return Argv{}, errors.New("no argument provided")
+	}
+	items, err := tokenize(args, false)
+	if err != nil {
+		return Argv{}, err
+	}
+	return parseArgs(items, nil, takesValue)
+}
+
+// ParseArgs parses giving arguments which are already split, such as
+// those of os.Args, keeping each argument whole without handling quotes.
+func ParseArgs(args []string) (Argv, error) {
+	return ParseArgsWithValues(args, nil)
+}
+
+// ParseArgsWithValues behaves like ParseArgs, with flags for which
+// giving ValueFunc returns true taking the following argument as their
+// value, as in ParseWithValues.
+func ParseArgsWithValues(args []string, takesValue ValueFunc) (Argv, error) {
+	if len(args) == 0 {
+		return Argv{}, errors.New("no argument provided")
+	}
+	return parseArgs(tokens(args), nil, takesValue)
+}
+
+// ParseWindows takes provided string, splits according to space and
+// parses arguments using windows syntax, where flags are prefixed with
+// `/` and use `:` to assign values, as in `/verbose` and `/name:value`.
+// Double quotes group text with spaces into one argument, while single
+// quotes and backslashes, as in paths, are kept as is.
+func ParseWindows(args string) (Argv, error) {
+	if len(args) == 0 {
+		return Argv{}, errors.New("no argument provided")
+	}
+
+	items, err := tokenize(args, true)
+	if err != nil {
+		return Argv{}, err
+	}
+	for i, item := range items {
+		if item.text == "--" {
+			break
+		}
+		if !strings.HasPrefix(item.text, "/") || len(item.text) == 1 {
+			continue
+		}
+		items[i].text = "--" + strings.Replace(item.text[1:], ":", "=", 1)
+	}
+	return parseArgs(items, nil, nil)
+}
+
+// parseArgs attempts to parse the slice of tokens
+// as a instance of Argv returning an error if one exists,
+// where parent holds the names of the enclosing commands.
+func parseArgs(args []token, parent []string, takesValue ValueFunc) (Argv, error) {
 	var argd Argv
 	argd.Pairs = map[string][]string{}
 
 	var withCommand bool
+	var path []string
 
 	for i := 0; i < len(args); i++ {
-		arg := args[i]
+		arg := args[i].text
+
+		// everything after the terminator is left untouched.
+		if arg == "--" {
+			argd.Remainder = texts(args[i+1:])
+			return argd, nil
+		}
 
 		if isIgnored(arg) {
 			continue
@@ -68,6 +209,7 @@ func parseArgs(args []string) (Argv, error) {
 			}
 
 			argd.Name = arg
+			path = append(parent[:len(parent):len(parent)], arg)
 			withCommand = true
 			continue
 		}
@@ -77,19 +219,21 @@ func parseArgs(args []string) (Argv, error) {
 		if !isFlag(arg) && withCommand {
 			rem := args[i:]
 			if len(rem) == 1 {
-				if !isFlag(rem[0]) {
-					argd.Text = rem[0]
+				if !isFlag(rem[0].text) {
+					argd.Text = rem[0].text
+					argd.Args = []string{rem[0].text}
 					return argd, nil
 				}
 			}
 
-			sub, err := parseArgs(rem)
+			sub, err := parseArgs(rem, path, takesValue)
 			if err != nil {
 				return argd, err
 			}
 
 			argd.Sub = &sub
-			argd.Text = strings.Join(args[i:], " ")
+			argd.Text = strings.Join(texts(args[i:]), " ")
+			argd.Args, argd.Remainder = splitTerminator(texts(args[i:]))
 			return argd, nil
 		}
 
@@ -109,28 +253,36 @@ func parseArgs(args []string) (Argv, error) {
 
 		// deal with the case of list values with either
 		// space seperated items or comma seperated items.
-		if isList(value) {
+		if args[i].quotedEmpty {
+			values = []string{""}
+		} else if isList(value) {
 			if isListEnd(value) {
 				items := strings.TrimSpace(value)
 				items = strings.TrimLeft(items, "[")
 				items = strings.TrimRight(items, "]")
-				values = strings.Split(items, ",")
+				// a quoted list holds its space seperated items in one argument.
+				if strings.ContainsAny(items, " \t") {
+					values = strings.Fields(strings.ReplaceAll(items, ",", " "))
+				} else {
+					values = strings.Split(items, ",")
+				}
 			} else {
 				list := make([]string, 0, 5)
 				if before := strings.TrimSpace(strings.TrimLeft(value, "[")); before != "" {
 					list = append(list, before)
 				}
 
-				for i+1 < len(args) && !isFlag(args[i+1]) && !isListEnd(args[i+1]) {
-					list = append(list, strings.TrimSpace(args[i+1]))
+				for i+1 < len(args) && !isFlag(args[i+1].text) && !isListEnd(args[i+1].text) {
+					list = append(list, strings.TrimSpace(args[i+1].text))
 					i++
 				}
 
-				if isListEnd(args[i+1]) {
-					end := strings.TrimSpace(strings.TrimSuffix(args[i+1], "]"))
-					list = append(list, end)
-					i++
+				if i+1 >= len(args) || !isListEnd(args[i+1].text) {
+					return argd, fmt.Errorf("flag %q has an unterminated list", key)
 				}
+				end := strings.TrimSpace(strings.TrimSuffix(args[i+1].text, "]"))
+				list = append(list, end)
+				i++
 
 				items := strings.Join(list, " ")
 				items = strings.TrimSpace(items)
@@ -151,15 +303,21 @@ func parseArgs(args []string) (Argv, error) {
 		// If we have a flag and there was an eq sign, then its a multi value
 		// type as we treat .
 		if key != "" && hasEq {
-			argd.Pairs[key] = values
+			argd.Pairs[key] = append(argd.Pairs[key], values...)
 			continue
 		}
 
 		// if there is a flag and no equal sign existed,  then we probably
 		// a branched in sub command, so get last index point, branch out
 		// after saving flag into current parent command.
+		if opt != "" && key == "" && !hasEq && takesValue != nil && i+1 < len(args) && (args[i+1].text == "" || isValue(args[i+1].text)) && takesValue(path, opt) {
+			argd.Pairs[opt] = append(argd.Pairs[opt], args[i+1].text)
+			i++
+			continue
+		}
+
 		if opt != "" && key == "" && !hasEq {
-			argd.Pairs[opt] = []string{"true"}
+			argd.Pairs[opt] = append(argd.Pairs[opt], "true")
 
 			// if we stopped around same index, then
 			// push forward.
@@ -172,19 +330,21 @@ func parseArgs(args []string) (Argv, error) {
 		if key == "" && !hasEq {
 			rem := args[lastIndex:]
 			if len(rem) == 1 {
-				if !isFlag(rem[0]) {
-					argd.Text = rem[0]
+				if !isFlag(rem[0].text) {
+					argd.Text = rem[0].text
+					argd.Args = []string{rem[0].text}
 					return argd, nil
 				}
 			}
 
-			sub, err := parseArgs(rem)
+			sub, err := parseArgs(rem, path, takesValue)
 			if err != nil {
 				return argd, err
 			}
 
 			argd.Sub = &sub
-			argd.Text = strings.Join(args[i:], " ")
+			argd.Text = strings.Join(texts(args[i:]), " ")
+			argd.Args, argd.Remainder = splitTerminator(texts(args[i:]))
 			return argd, nil
 		}
 	}
@@ -192,19 +352,114 @@ func parseArgs(args []string) (Argv, error) {
 	return argd, nil
 }
 
+// token is an argument produced by tokenize, where quotedEmpty marks
+// an assignment of an empty quoted string, as in `--msg=""`, which is
+// kept as an empty value unlike `--msg=`.
+type token struct {
+	text        string
+	quotedEmpty bool
+}
+
+// tokens returns giving arguments, which are already split, as tokens.
+func tokens(args []string) []token {
+	items := make([]token, len(args))
+	for i, arg := range args {
+		items[i] = token{text: arg}
+	}
+	return items
+}
+
+// texts returns the text of giving tokens.
+func texts(items []token) []string {
+	args := make([]string, len(items))
+	for i, item := range items {
+		args[i] = item.text
+	}
+	return args
+}
+
+// tokenize splits giving arguments on spaces outside of quotes, removing
+// the quotes, where backslashes escape the following character outside
+// of single quotes. In windows mode, only double quotes group arguments
+// and backslashes are kept as is.
+func tokenize(args string, windows bool) ([]token, error) {
+	var items []token
+	var current strings.Builder
+	var inToken, emptyValue bool
+	var quote rune
+
+	runes := []rune(args)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0 && r == quote:
+			// an empty quoted value closing an assignment is kept.
+			if runes[i-1] == quote && strings.HasSuffix(current.String(), "=") {
+				emptyValue = true
+			}
+			quote = 0
+		case quote == '"' && r == '\\' && !windows && i+1 < len(runes) && strings.ContainsRune("\"\\$`", runes[i+1]):
+			i++
+			current.WriteRune(runes[i])
+			emptyValue = false
+		case quote != 0:
+			current.WriteRune(r)
+			emptyValue = false
+		case r == '"' || r == '\'' && !windows:
+			quote = r
+			inToken = true
+		case r == '\\' && !windows && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+			inToken, emptyValue = true, false
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inToken {
+				items = append(items, token{text: current.String(), quotedEmpty: emptyValue})
+			}
+			current.Reset()
+			inToken, emptyValue = false, false
+		default:
+			current.WriteRune(r)
+			inToken, emptyValue = true, false
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in arguments", quote)
+	}
+	if inToken {
+		items = append(items, token{text: current.String(), quotedEmpty: emptyValue})
+	}
+	return items, nil
+}
+
+// splitTerminator returns copies of the arguments before and after
+// the `--` terminator.
+func splitTerminator(args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return append([]string{}, args[:i]...), append([]string{}, args[i+1:]...)
+		}
+	}
+	return append([]string{}, args...), nil
+}
+
 // isFlag returns true if a token is a flag such as "-v" or "--user" but not "-" or "--"
 func isFlag(s string) bool {
 	return strings.HasPrefix(s, "-") && strings.TrimLeft(s, "-") != ""
 }
 
+// isValue returns true if a token following a flag can be its value.
+func isValue(s string) bool {
+	return !isFlag(s) && !isList(s) && !isIgnored(s) && s != "--"
+}
+
 func isIgnored(s string) bool {
 	switch s {
 	case "":
 		return true
 	case "-":
 		return true
-	case "--":
-		return true
 	}
 	return false
 }
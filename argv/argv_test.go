@@ -2,6 +2,7 @@ package argv_test
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/gokit/cmdkit/argv"
@@ -155,3 +156,237 @@ func notEmpty(t *testing.T, item interface{}) {
 		t.Fatal("Value is not a map, slice, array, string or channel")
 	}
 }
+
+func TestParseArgsWithRemainder(t *testing.T) {
+	arg, err := argv.Parse("mycli --verbose run -- echo --hello world")
+	noError(t, err)
+	notNil(t, arg.Sub)
+	contains(t, arg.Pairs, "verbose")
+	equal(t, "run", arg.Sub.Name)
+	isEmpty(t, arg.Sub.Text)
+	if !reflect.DeepEqual(arg.Sub.Remainder, []string{"echo", "--hello", "world"}) {
+		t.Fatalf("Should have left remainder untouched: %#v\n", arg.Sub.Remainder)
+	}
+}
+
+func TestParseArgsWithCommaList(t *testing.T) {
+	arg, err := argv.Parse("mycli --tags=a,b push origin")
+	noError(t, err)
+	notNil(t, arg.Sub)
+	contains(t, arg.Pairs["tags"], "a,b")
+	equal(t, "push", arg.Sub.Name)
+	equal(t, "origin", arg.Sub.Text)
+}
+
+func TestParseArgsWithSpacedCommaList(t *testing.T) {
+	takesValue := func(path []string, flag string) bool {
+		return flag == "tags"
+	}
+	arg, err := argv.ParseArgsWithValues([]string{"mycli", "--tags", "a,b", "push", "origin"}, takesValue)
+	noError(t, err)
+	notNil(t, arg.Sub)
+	contains(t, arg.Pairs["tags"], "a,b")
+	equal(t, "push", arg.Sub.Name)
+	equal(t, "origin", arg.Sub.Text)
+}
+
+func TestParseArgsKeepsTrailingArgs(t *testing.T) {
+	arg, err := argv.Parse("mycli show file.txt other.txt")
+	noError(t, err)
+	notNil(t, arg.Sub)
+	equal(t, "show", arg.Sub.Name)
+	equal(t, "file.txt other.txt", arg.Sub.Text)
+	if !reflect.DeepEqual(arg.Sub.Args, []string{"file.txt", "other.txt"}) {
+		t.Fatalf("Should have kept trailing args: %#v\n", arg.Sub.Args)
+	}
+}
+
+func TestParseArgsKeepsTrailingArgsBeforeTerminator(t *testing.T) {
+	arg, err := argv.Parse("mycli run file.txt other.txt -- echo hello")
+	noError(t, err)
+	notNil(t, arg.Sub)
+	equal(t, "run", arg.Sub.Name)
+	if !reflect.DeepEqual(arg.Sub.Args, []string{"file.txt", "other.txt"}) {
+		t.Fatalf("Should have kept trailing args before terminator: %#v\n", arg.Sub.Args)
+	}
+	if !reflect.DeepEqual(arg.Sub.Remainder, []string{"echo", "hello"}) {
+		t.Fatalf("Should have kept remainder: %#v\n", arg.Sub.Remainder)
+	}
+}
+
+func TestParseArgsWithAssignmentInValue(t *testing.T) {
+	arg, err := argv.Parse("mycli --query=a=b=c --filter=[k=v,x==y] --eq== search")
+	noError(t, err)
+	equal(t, "search", arg.Text)
+	if !reflect.DeepEqual(arg.Pairs["query"], []string{"a=b=c"}) {
+		t.Fatalf("Should have kept value after first assignment: %#v\n", arg.Pairs["query"])
+	}
+	if !reflect.DeepEqual(arg.Pairs["filter"], []string{"k=v", "x==y"}) {
+		t.Fatalf("Should have kept assignments in list values: %#v\n", arg.Pairs["filter"])
+	}
+	if !reflect.DeepEqual(arg.Pairs["eq"], []string{"="}) {
+		t.Fatalf("Should have kept lone assignment as value: %#v\n", arg.Pairs["eq"])
+	}
+}
+
+func TestFlattenPositionalWithFlags(t *testing.T) {
+	arg, err := argv.Parse("mycli push repo.git --force")
+	noError(t, err)
+	notNil(t, arg.Sub)
+	equal(t, "push", arg.Sub.Name)
+
+	push := arg.Sub.Flatten()
+	isNil(t, push.Sub)
+	equal(t, "push", push.Name)
+	equal(t, "repo.git", push.Text)
+	equal(t, 1, len(push.Args))
+	equal(t, "repo.git", push.Args[0])
+	contains(t, push.Pairs, "force")
+	contains(t, push.Pairs["force"], "true")
+}
+
+func TestFlattenKeepsEarlierPairs(t *testing.T) {
+	arg, err := argv.Parse("push --tag=v1 origin main --tag=v2 --dry")
+	noError(t, err)
+
+	push := arg.Flatten()
+	isNil(t, push.Sub)
+	equal(t, "origin main", push.Text)
+	contains(t, push.Pairs, "dry")
+	contains(t, push.Pairs["tag"], "v1")
+}
+
+func TestParseWindows(t *testing.T) {
+	arg, err := argv.ParseWindows("tool /verbose /name:value /path:C:\\temp")
+	noError(t, err)
+	equal(t, "tool", arg.Name)
+	contains(t, arg.Pairs, "verbose")
+	contains(t, arg.Pairs["verbose"], "true")
+	contains(t, arg.Pairs, "name")
+	contains(t, arg.Pairs["name"], "value")
+	contains(t, arg.Pairs, "path")
+	contains(t, arg.Pairs["path"], "C:\\temp")
+}
+
+func TestParseRepeatedFlags(t *testing.T) {
+	arg, err := argv.Parse("exec --env=A=1 --env=B=2 -v -v")
+	noError(t, err)
+	equal(t, 2, len(arg.Pairs["env"]))
+	equal(t, "A=1", arg.Pairs["env"][0])
+	equal(t, "B=2", arg.Pairs["env"][1])
+	equal(t, 2, len(arg.Pairs["v"]))
+}
+
+func TestParseWithValues(t *testing.T) {
+	var paths [][]string
+	takesValue := func(path []string, flag string) bool {
+		paths = append(paths, path)
+		return flag == "name"
+	}
+
+	for _, args := range []string{"rocket --verbose --name wallet push", "rocket --verbose --name=wallet push"} {
+		arg, err := argv.ParseWithValues(args, takesValue)
+		noError(t, err)
+		equal(t, "rocket", arg.Name)
+		equal(t, "wallet", arg.Pairs["name"][0])
+		equal(t, "true", arg.Pairs["verbose"][0])
+		equal(t, "push", arg.Text)
+	}
+
+	arg, err := argv.ParseWithValues("rocket push --name wallet --tags [a b]", takesValue)
+	noError(t, err)
+	notNil(t, arg.Sub)
+	equal(t, "wallet", arg.Sub.Pairs["name"][0])
+	equal(t, "rocket/push", strings.Join(paths[len(paths)-1], "/"))
+
+	arg, err = argv.ParseWithValues("rocket --name --verbose", takesValue)
+	noError(t, err)
+	equal(t, "true", arg.Pairs["name"][0])
+}
+
+func TestParseWithValuesKeepsEmptyValue(t *testing.T) {
+	takesValue := func(path []string, flag string) bool {
+		return flag == "msg"
+	}
+
+	arg, err := argv.ParseArgsWithValues([]string{"rocket", "--msg", "", "--verbose", ""}, takesValue)
+	noError(t, err)
+	equal(t, 1, len(arg.Pairs["msg"]))
+	equal(t, "", arg.Pairs["msg"][0])
+	equal(t, "true", arg.Pairs["verbose"][0])
+
+	arg, err = argv.ParseWithValues(`rocket --msg "" push`, takesValue)
+	noError(t, err)
+	equal(t, "", arg.Pairs["msg"][0])
+	equal(t, "push", arg.Text)
+}
+
+func TestParseQuotedValues(t *testing.T) {
+	arg, err := argv.Parse(`echo --msg="hello world" --nested='say "hi" twice' --escaped="say \"hi\"" --empty="" --plain=hello\ there`)
+	noError(t, err)
+	equal(t, 1, len(arg.Pairs["msg"]))
+	equal(t, "hello world", arg.Pairs["msg"][0])
+	equal(t, `say "hi" twice`, arg.Pairs["nested"][0])
+	equal(t, `say "hi"`, arg.Pairs["escaped"][0])
+	equal(t, 1, len(arg.Pairs["empty"]))
+	equal(t, "", arg.Pairs["empty"][0])
+	equal(t, "hello there", arg.Pairs["plain"][0])
+
+	arg, err = argv.Parse(`echo --names=[a b c] --msg='it is' "two words"`)
+	noError(t, err)
+	equal(t, 3, len(arg.Pairs["names"]))
+	equal(t, "it is", arg.Pairs["msg"][0])
+	equal(t, "two words", arg.Text)
+
+	_, err = argv.Parse(`echo --msg="hello`)
+	if err == nil {
+		t.Fatal("Should have failed with unterminated quote")
+	}
+}
+
+func TestParseQuotedEmptyValueOfArguments(t *testing.T) {
+	arg, err := argv.Parse(`echo run --after="" key=""`)
+	noError(t, err)
+	notNil(t, arg.Sub)
+	equal(t, "", arg.Sub.Pairs["after"][0])
+	equal(t, "key=", arg.Sub.Text)
+	if !reflect.DeepEqual(arg.Sub.Args, []string{"key="}) {
+		t.Fatalf("Should have kept argument without a marker: %q\n", arg.Sub.Args)
+	}
+}
+
+func TestJoinRoundTrips(t *testing.T) {
+	args := []string{"echo", "--msg=it's here", `--path=C:\temp`, "--names=[a b c]"}
+	arg, err := argv.Parse(argv.Join(args))
+	noError(t, err)
+	equal(t, "it's here", arg.Pairs["msg"][0])
+	equal(t, `C:\temp`, arg.Pairs["path"][0])
+	equal(t, 3, len(arg.Pairs["names"]))
+}
+
+func TestParseArgsKeepsArgumentsWhole(t *testing.T) {
+	arg, err := argv.ParseArgs([]string{"echo", `--msg=say "hi" twice`, "--names=[a", "b]", "two words"})
+	noError(t, err)
+	equal(t, "echo", arg.Name)
+	equal(t, `say "hi" twice`, arg.Pairs["msg"][0])
+	equal(t, 2, len(arg.Pairs["names"]))
+	equal(t, "two words", arg.Text)
+
+	_, err = argv.ParseArgs(nil)
+	if err == nil {
+		t.Fatal("Should have failed without arguments")
+	}
+}
+
+func TestParseUnterminatedList(t *testing.T) {
+	for _, args := range [][]string{
+		{"mycli", "add", "--tags=[a"},
+		{"mycli", "add", "--tags=[a", "b"},
+		{"mycli", "add", "--tags=[a", "--verbose"},
+	} {
+		_, err := argv.ParseArgs(args)
+		if err == nil || err.Error() != `flag "tags" has an unterminated list` {
+			t.Fatalf("Should have failed with unterminated list of %q: %v", args, err)
+		}
+	}
+}
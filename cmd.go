@@ -7,8 +7,13 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -23,7 +28,7 @@ const (
 
 ⡿ COMMANDS:{{ range .Commands }}
 
-	⠙ {{toLower .Name }}        {{if isEmpty .ShortDesc }}{{cutoff .Desc 100 }}{{else}}{{cutoff .ShortDesc 100 }}{{end}}
+	⠙ {{toLower .Name }}        {{if .Deprecated }}(deprecated) {{end}}{{if isEmpty .ShortDesc }}{{cutoff .Desc 100 }}{{else}}{{cutoff .ShortDesc 100 }}{{end}}
 {{end}}
 ⡿ HELP:
 
@@ -57,7 +62,11 @@ const (
 ⡿ DESC:
 
 	{{.Cmd.Desc}}
+{{if .Cmd.Deprecated }}
+⡿ DEPRECATED:
 
+	{{.Cmd.Deprecated}}
+{{end}}
 ⡿ HELP:
 
 	Run {{toLower .Cmd.Name}} --help to print this message.
@@ -67,10 +76,17 @@ const (
 ⡿ Flags:
 	{{$title := toLower .Title}}{{$cmdName := .Cmd.Name}}{{ range $_, $fl := .Cmd.Flags }}
 	⠙ --{{toLower $fl.FlagName}}  ({{.TypeString}})  {{ if .Default }}Default: {{.Default}}{{end}}  {{ if .Desc }}Desc: {{.Desc}}{{end}}
-	{{end}}
+	{{end}}{{if .GlobalFlags }}
+⡿ Global Flags:
+	{{ range $_, $fl := .GlobalFlags }}
+	⠙ --{{toLower $fl.FlagName}}  ({{.TypeString}})  {{ if .Default }}Default: {{.Default}}{{end}}  {{ if .Desc }}Desc: {{.Desc}}{{end}}
+	{{end}}{{end}}
 ⡿ Examples:
 	{{ range $_, $content := .Cmd.Usages }}
 	⠙ {{$content}}
+	{{end}}{{ range $_, $example := .Cmd.Examples }}
+	⠙ {{$example.Command}}
+	    {{$example.Description}}
 	{{end}}
 ⡿ USAGE:
 	{{ range $_, $fl := .Cmd.Flags }}
@@ -78,7 +94,7 @@ const (
 	{{end}}
 ⡿ SUB COMMANDS:{{ range .Commands }}
 
-	⠙ {{toLower .Name }}       {{if isEmpty .ShortDesc }}{{cutoff .Desc 100 }}{{else}}{{cutoff .ShortDesc 100 }}{{end}}
+	⠙ {{toLower .Name }}       {{if .Deprecated }}(deprecated) {{end}}{{if isEmpty .ShortDesc }}{{cutoff .Desc 100 }}{{else}}{{cutoff .ShortDesc 100 }}{{end}}
 {{end}}
 
 `
@@ -87,7 +103,21 @@ const (
 var (
 	printFlag   = BoolFlag(FlagName("flags"), FlagDesc("Show all commands flags"))
 	helpFlag    = BoolFlag(FlagName("help"), FlagAlias("h"), FlagDesc("Show command help message"))
-	timeoutFlag = DurationFlag(FlagName("timeout"), FlagAlias("tm"), FlagDesc("set timeout for command context"))
+	timeoutFlag = DurationFlag(FlagName("timeout"), FlagAlias("tm"), Env("CMDKIT_TIMEOUT"), FlagDesc("set timeout for command context"))
+	versionFlag = BoolFlag(FlagName("version"), FlagDesc("Show program version"))
+	timingsFlag = BoolFlag(FlagName("timings"), FlagDesc("Print elapsed time of command"))
+	dryRunFlag  = BoolFlag(FlagName("dry-run"), FlagDesc("Run command without side effects"))
+	quietFlag   = BoolFlag(FlagName("quiet"), FlagAlias("q"), FlagDesc("Suppress all non-error output"))
+
+	argsFileFlag = StringFlag(FlagName("args-file"), FlagDesc("Read flags of command from file"))
+
+	plainReplacer = strings.NewReplacer(
+		"⡿ Flags:", "FLAGS:",
+		"⡿ Global Flags:", "GLOBAL FLAGS:",
+		"⡿ Examples:", "EXAMPLES:",
+		"⡿ ", "",
+		"⠙", "*",
+	)
 
 	defs = template.FuncMap{
 		"toLower": strings.ToLower,
@@ -95,15 +125,83 @@ var (
 		"isEmpty": func(val string) bool {
 			return strings.TrimSpace(val) == ""
 		},
-		"cutoff": func(val string, limit int) string {
-			if len(val) > limit {
-				return val[:limit] + "..."
+		"cutoff": cutoff,
+	}
+)
+
+// preserveCaseDefs returns a copy of the template functions where
+// toLower keeps the case of giving text.
+func preserveCaseDefs() template.FuncMap {
+	funcs := template.FuncMap{}
+	for name, fn := range defs {
+		funcs[name] = fn
+	}
+	funcs["toLower"] = func(val string) string {
+		return val
+	}
+	return funcs
+}
+
+// cutoff shortens giving text to at most limit characters, breaking at
+// the last space before the limit rather than within a word, with an
+// ellipsis added only when the text was shortened.
+func cutoff(val string, limit int) string {
+	runes := []rune(val)
+	if len(runes) <= limit {
+		return val
+	}
+
+	cut := runes[:limit]
+	if runes[limit] != ' ' {
+		for i := len(cut) - 1; i > 0; i-- {
+			if cut[i] == ' ' {
+				cut = cut[:i]
+				break
 			}
-			return val
-		},
+		}
 	}
+	return strings.TrimRight(string(cut), " ") + "..."
+}
+
+// lists of sources a flag value can be resolved from.
+const (
+	SourceFlag    = "flag"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceConfig  = "config"
+	SourceKeyring = "keyring"
+	SourceDefault = "default"
 )
 
+// secretMask replaces the value of secret flags wherever they are reported.
+const secretMask = "******"
+
+// UsageError is returned when a command was invoked wrongly, such as
+// with invalid flags or unexpected arguments, as opposed to errors of
+// running the command, carrying the usage text of the command.
+type UsageError struct {
+	Err   error
+	Usage string
+}
+
+// Error implements the error interface.
+func (e *UsageError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *UsageError) Unwrap() error {
+	return e.Err
+}
+
+// ErrHelp is returned when help was requested and printed instead of
+// executing a command.
+var ErrHelp = errors.New("help requested")
+
+// ErrVersion is returned when the version was requested and printed
+// instead of executing a command.
+var ErrVersion = errors.New("version requested")
+
 // FlagType defines a int to represent a giving flag type.
 type FlagType int
 
@@ -130,6 +228,13 @@ const (
 	StringList
 	Float64List
 	DurationList
+	Enum
+	EnvVarList
+	SetMap
+	HeaderMap
+	UInt8
+	UInt16
+	UInt32
 )
 
 // TypeString returns name of flag.
@@ -145,6 +250,12 @@ func (s FlagType) TypeString() string {
 		return "int32"
 	case UInt64:
 		return "uint64"
+	case UInt8:
+		return "uint8"
+	case UInt16:
+		return "uint16"
+	case UInt32:
+		return "uint32"
 	case Int16:
 		return "int16"
 	case Int64:
@@ -174,13 +285,97 @@ func (s FlagType) TypeString() string {
 	case StringList:
 		return "[]string"
 	case Float64List:
-		return "[]int64"
+		return "[]float64"
 	case DurationList:
 		return "[]time.Duration"
+	case Enum:
+		return "enum"
+	case EnvVarList:
+		return "[]string"
+	case SetMap:
+		return "map[string]interface{}"
+	case HeaderMap:
+		return "http.Header"
 	}
 	return "unknown"
 }
 
+// IsList returns true/false if the flag type holds a list of values.
+func (s FlagType) IsList() bool {
+	switch s {
+	case IntList, Int64List, UIntList, UInt64List, BoolList, StringList, Float64List, DurationList, EnvVarList:
+		return true
+	}
+	return false
+}
+
+// accumulates returns true/false if the flag type takes the values of
+// all repeated uses of the flag rather than the last one.
+func (s FlagType) accumulates() bool {
+	return s.IsList() || s == SetMap || s == HeaderMap
+}
+
+// accepts returns true/false if giving value is of the go type
+// expected by the flag type.
+func (s FlagType) accepts(value interface{}) bool {
+	var ok bool
+	switch s {
+	case Int:
+		_, ok = value.(int)
+	case UInt:
+		_, ok = value.(uint)
+	case Int8:
+		_, ok = value.(int8)
+	case Int16:
+		_, ok = value.(int16)
+	case Int32:
+		_, ok = value.(int32)
+	case Int64:
+		_, ok = value.(int64)
+	case UInt64:
+		_, ok = value.(uint64)
+	case UInt8:
+		_, ok = value.(uint8)
+	case UInt16:
+		_, ok = value.(uint16)
+	case UInt32:
+		_, ok = value.(uint32)
+	case Bool, TBool:
+		_, ok = value.(bool)
+	case String:
+		_, ok = value.(string)
+	case Float32:
+		_, ok = value.(float32)
+	case Float64:
+		_, ok = value.(float64)
+	case Duration:
+		_, ok = value.(time.Duration)
+	case IntList:
+		_, ok = value.([]int)
+	case Int64List:
+		_, ok = value.([]int64)
+	case UIntList:
+		_, ok = value.([]uint)
+	case UInt64List:
+		_, ok = value.([]uint64)
+	case BoolList:
+		_, ok = value.([]bool)
+	case StringList, EnvVarList:
+		_, ok = value.([]string)
+	case SetMap:
+		_, ok = value.(map[string]interface{})
+	case HeaderMap:
+		_, ok = value.(http.Header)
+	case Float64List:
+		_, ok = value.([]float64)
+	case DurationList:
+		_, ok = value.([]time.Duration)
+	default:
+		ok = true
+	}
+	return ok
+}
+
 // ValueValidation defines a function type for the purpose
 // of validating a giving string input.
 type ValueValidation func(string, ...string) error
@@ -246,17 +441,117 @@ func Env(s string) FlagOption {
 	}
 }
 
+// ParseError returns a FlagOption that sets the message of the error
+// returned when the value of a Flag fails to parse.
+func ParseError(msg string) FlagOption {
+	return func(fl *Flag) {
+		fl.ParseErrorMessage = msg
+	}
+}
+
+// Secret returns a FlagOption that marks a Flag as sensitive, masking
+// it's value wherever it is reported.
+func Secret() FlagOption {
+	return func(fl *Flag) {
+		fl.Secret = true
+	}
+}
+
+// FlagRequired returns a FlagOption that marks a Flag as required,
+// failing the command before its action runs when the flag is neither
+// provided nor resolved from its environment variable, config or default.
+func FlagRequired() FlagOption {
+	return func(fl *Flag) {
+		fl.Required = true
+	}
+}
+
+// FlagNoValue returns a FlagOption that marks a Flag as taking no
+// value, such that `--name` followed by another argument is set to
+// "true" instead of taking that argument as its value, as with bool
+// flags.
+func FlagNoValue() FlagOption {
+	return func(fl *Flag) {
+		fl.NoValue = true
+	}
+}
+
+// ListDelimiter returns a FlagOption that sets the delimiter splitting
+// a single value of a list Flag into its items, such as ':' for
+// PATH like values, in place of the default comma.
+func ListDelimiter(r rune) FlagOption {
+	return func(fl *Flag) {
+		fl.Delimiter = r
+	}
+}
+
+// BindTo returns a FlagOption that sets the pointer the resolved value
+// of a Flag is stored into, such as the field of a configuration struct.
+func BindTo(ptr interface{}) FlagOption {
+	return func(fl *Flag) {
+		fl.Target = ptr
+	}
+}
+
+// DefaultFromFlag returns a FlagOption that defaults a Flag to the
+// resolved value of the flag of giving name, falling back to its own
+// default when that flag has no value.
+func DefaultFromFlag(name string) FlagOption {
+	return func(fl *Flag) {
+		fl.DefaultFrom = name
+	}
+}
+
+// ElementParser returns a FlagOption that sets the ParseFunction used
+// on each item of a list Flag, which must return items of the type of
+// the list, such as time.Duration for a DurationListFlag, or on each
+// value of a SetFlag.
+func ElementParser(n ParseFunction) FlagOption {
+	return func(fl *Flag) {
+		fl.ElementParser = n
+	}
+}
+
+// ValueAliases returns a FlagOption that sets the map of alternative
+// values of a Flag to their canonical value, such as "h2" to "http2",
+// replacing each received value before validation and parsing.
+func ValueAliases(aliases map[string]string) FlagOption {
+	return func(fl *Flag) {
+		fl.ValueAliases = aliases
+	}
+}
+
+// OneOf returns a FlagOption that sets the values a Flag accepts,
+// failing for any other value, which are also offered by shell
+// completion.
+func OneOf(values ...string) FlagOption {
+	return func(fl *Flag) {
+		fl.Choices = values
+	}
+}
+
 // Flag implements a structure for parsing string flags.
 type Flag struct {
-	Name       string
-	Alias      string
-	Env        string
-	Desc       string
-	Type       FlagType
-	Default    interface{}
-	Morph      MorphFunction
-	Parser     ParseFunction
-	Validation ValueValidation
+	Name              string
+	Alias             string
+	Env               string
+	Desc              string
+	Type              FlagType
+	Default           interface{}
+	Morph             MorphFunction
+	Parser            ParseFunction
+	Validation        ValueValidation
+	ParseErrorMessage string
+	Secret            bool
+	Delimiter         rune
+	Target            interface{}
+	DefaultFrom       string
+	ElementParser     ParseFunction
+	ValueAliases      map[string]string
+	Keyring           string
+	Choices           []string
+	NoValue           bool
+	Required          bool
 }
 
 // FlagAlias returns alias of flag.
@@ -279,15 +574,125 @@ func (s *Flag) DefaultValue() interface{} {
 	return s.Default
 }
 
+// ValidateDefault returns an error if the default of the flag can not
+// be used as its value. A string default of a non-string flag is run
+// through the parser of the flag, any other default must be of the
+// type expected by the flag.
+func (s *Flag) ValidateDefault() error {
+	if s.Default == nil {
+		return nil
+	}
+
+	// string defaults of flags without a parser are checked by type below.
+	if value, ok := s.Default.(string); ok && s.Type != String && s.Parser != nil {
+		_, err := s.Parse(value)
+		return err
+	}
+
+	if !s.Type.accepts(s.Default) {
+		return fmt.Errorf("flag %q: default %v is not a valid %s", s.Name, s.Default, s.Type.TypeString())
+	}
+	return nil
+}
+
+// assign stores giving value into the bound target of the flag if any,
+// converting it when the target is of a named type of the same kind.
+func (s *Flag) assign(value interface{}) error {
+	if s.Target == nil {
+		return nil
+	}
+
+	target := reflect.ValueOf(s.Target)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("flag %q: bind target must be a non-nil pointer, got %T", s.Name, s.Target)
+	}
+
+	elem := target.Elem()
+	val := reflect.ValueOf(value)
+	if !val.Type().AssignableTo(elem.Type()) {
+		if val.Kind() != elem.Kind() || !val.Type().ConvertibleTo(elem.Type()) {
+			return fmt.Errorf("flag %q: can not bind %s value to %s", s.Name, val.Type(), elem.Type())
+		}
+		val = val.Convert(elem.Type())
+	}
+	elem.Set(val)
+	return nil
+}
+
+// parseElements parses each of giving items with the element parser
+// of the flag into a slice of the type of the parsed items, which must
+// be the type of the list flag.
+func (s *Flag) parseElements(m string, rest ...string) (interface{}, error) {
+	var items reflect.Value
+	for _, item := range append([]string{m}, rest...) {
+		value, err := s.ElementParser(item)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return nil, fmt.Errorf("flag %q: element parser returned no value for %q", s.Name, item)
+		}
+
+		parsed := reflect.ValueOf(value)
+		if !items.IsValid() {
+			items = reflect.MakeSlice(reflect.SliceOf(parsed.Type()), 0, len(rest)+1)
+		}
+		if parsed.Type() != items.Type().Elem() {
+			return nil, fmt.Errorf("flag %q: mixed %s and %s items", s.Name, items.Type().Elem(), parsed.Type())
+		}
+		items = reflect.Append(items, parsed)
+	}
+
+	if !s.Type.accepts(items.Interface()) {
+		return nil, fmt.Errorf("flag %q: element parser returned %s items for a %s flag", s.Name, items.Type().Elem(), s.Type.TypeString())
+	}
+	return items.Interface(), nil
+}
+
 // Parse sets the underline flag ready for value receiving.
+// List flags given a single value separated by the list delimiter,
+// a comma by default, receive each item of the value as an element.
 func (s *Flag) Parse(m string, rest ...string) (interface{}, error) {
+	delimiter := ","
+	if s.Delimiter != 0 {
+		delimiter = string(s.Delimiter)
+	}
+	// values of environment variables may contain the delimiter.
+	if s.Type.IsList() && s.Type != EnvVarList && len(rest) == 0 && strings.Contains(m, delimiter) {
+		items := strings.Split(m, delimiter)
+		m, rest = items[0], items[1:]
+	}
+
+	if len(s.ValueAliases) != 0 {
+		m, rest = s.canonical(m), append([]string(nil), rest...)
+		for index, item := range rest {
+			rest[index] = s.canonical(item)
+		}
+	}
+
+	if len(s.Choices) != 0 {
+		for _, value := range append([]string{m}, rest...) {
+			if !s.allows(value) {
+				return nil, fmt.Errorf("flag %q: %q is not one of %s", s.Name, value, strings.Join(s.Choices, ", "))
+			}
+		}
+	}
+
 	if s.Validation != nil {
 		if err := s.Validation(m, rest...); err != nil {
 			return nil, err
 		}
 	}
 
-	value, err := s.Parser(m, rest...)
+	parser := s.Parser
+	if s.ElementParser != nil && s.Type.IsList() {
+		parser = s.parseElements
+	}
+
+	value, err := parser(m, rest...)
+	if err != nil && s.ParseErrorMessage != "" {
+		return nil, errors.New(s.ParseErrorMessage)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -299,12 +704,63 @@ func (s *Flag) Parse(m string, rest ...string) (interface{}, error) {
 	return s.Morph(value)
 }
 
+// takesValue returns true/false if the flag takes the argument following
+// it as value when provided without `=`, as in `--name wallet`.
+func (s *Flag) takesValue() bool {
+	return !s.NoValue && s.Type != Bool && s.Type != TBool
+}
+
+// allows returns true/false if giving value is one of the choices of
+// the flag.
+func (s *Flag) allows(value string) bool {
+	for _, choice := range s.Choices {
+		if choice == value {
+			return true
+		}
+	}
+	return false
+}
+
+// canonical returns the value giving value is an alias of, or the
+// value itself if it has none.
+func (s *Flag) canonical(value string) string {
+	if canonical, ok := s.ValueAliases[value]; ok {
+		return canonical
+	}
+	return value
+}
+
+// invalidValue returns the error reported when giving value of the named
+// flag can not be parsed into the flag's type.
+func invalidValue(name string, value string, kind string) error {
+	return fmt.Errorf("flag %q: %q is not a valid %s", name, value, kind)
+}
+
 // Flags returns the passed in set of variadic arguments
 // returning them as a slice.
 func Flags(flags ...Flag) []Flag {
 	return flags
 }
 
+// MergeFlags combines the provided sets of flags, where flags of later
+// sets replace those of earlier sets with the same name, keeping the
+// order in which names first appeared.
+func MergeFlags(sets ...[]Flag) []Flag {
+	index := map[string]int{}
+	merged := make([]Flag, 0, len(sets))
+	for _, set := range sets {
+		for _, flag := range set {
+			if pos, ok := index[flag.FlagName()]; ok {
+				merged[pos] = flag
+				continue
+			}
+			index[flag.FlagName()] = len(merged)
+			merged = append(merged, flag)
+		}
+	}
+	return merged
+}
+
 // MakeFlag creates a flag for list of list strings.
 func MakeFlag(ops ...FlagOption) Flag {
 	var impl Flag
@@ -320,7 +776,7 @@ func UInt64ListFlag(ops ...FlagOption) Flag {
 	impl.Type = UInt64List
 	if impl.Default != nil {
 		if _, ok := impl.Default.([]uint64); !ok {
-			log.Fatalf("Flag %q must use type []int64 default value types", impl.Name)
+			log.Fatalf("Flag %q must use type []uint64 default value types", impl.Name)
 		}
 	}
 	impl.Parser = func(s string, rem ...string) (interface{}, error) {
@@ -332,7 +788,7 @@ func UInt64ListFlag(ops ...FlagOption) Flag {
 
 		initial, err := strconv.ParseUint(s, 10, 64)
 		if err != nil {
-			return nil, err
+			return nil, invalidValue(impl.Name, s, "uint64")
 		}
 
 		elem := make([]uint64, 0, 1+len(rem))
@@ -341,7 +797,7 @@ func UInt64ListFlag(ops ...FlagOption) Flag {
 		for _, item := range rem {
 			conv, err := strconv.ParseUint(item, 10, 64)
 			if err != nil {
-				return nil, err
+				return nil, invalidValue(impl.Name, item, "uint64")
 			}
 			elem = append(elem, conv)
 		}
@@ -366,18 +822,18 @@ func Int64ListFlag(ops ...FlagOption) Flag {
 			}
 		}
 
-		initial, err := strconv.ParseInt(s, 10, 64)
+		initial, err := strconv.ParseInt(s, 0, 64)
 		if err != nil {
-			return nil, err
+			return nil, invalidValue(impl.Name, s, "int64")
 		}
 
 		elem := make([]int64, 0, 1+len(rem))
 		elem = append(elem, initial)
 
 		for _, item := range rem {
-			conv, err := strconv.ParseInt(item, 10, 64)
+			conv, err := strconv.ParseInt(item, 0, 64)
 			if err != nil {
-				return nil, err
+				return nil, invalidValue(impl.Name, item, "int64")
 			}
 			elem = append(elem, conv)
 		}
@@ -404,7 +860,7 @@ func Float64ListFlag(ops ...FlagOption) Flag {
 
 		initial, err := strconv.ParseFloat(s, 64)
 		if err != nil {
-			return nil, err
+			return nil, invalidValue(impl.Name, s, "float64")
 		}
 
 		elem := make([]float64, 0, 1+len(rem))
@@ -413,7 +869,7 @@ func Float64ListFlag(ops ...FlagOption) Flag {
 		for _, item := range rem {
 			conv, err := strconv.ParseFloat(item, 64)
 			if err != nil {
-				return nil, err
+				return nil, invalidValue(impl.Name, item, "float64")
 			}
 			elem = append(elem, conv)
 		}
@@ -440,7 +896,7 @@ func BoolListFlag(ops ...FlagOption) Flag {
 
 		initial, err := strconv.ParseBool(s)
 		if err != nil {
-			return nil, err
+			return nil, invalidValue(impl.Name, s, "bool")
 		}
 
 		elem := make([]bool, 0, 1+len(rem))
@@ -449,7 +905,7 @@ func BoolListFlag(ops ...FlagOption) Flag {
 		for _, item := range rem {
 			conv, err := strconv.ParseBool(item)
 			if err != nil {
-				return nil, err
+				return nil, invalidValue(impl.Name, item, "bool")
 			}
 			elem = append(elem, conv)
 		}
@@ -476,7 +932,7 @@ func UIntListFlag(ops ...FlagOption) Flag {
 
 		initial, err := strconv.ParseUint(s, 10, 64)
 		if err != nil {
-			return nil, err
+			return nil, invalidValue(impl.Name, s, "uint")
 		}
 
 		elem := make([]uint, 0, 1+len(rem))
@@ -485,7 +941,7 @@ func UIntListFlag(ops ...FlagOption) Flag {
 		for _, item := range rem {
 			conv, err := strconv.ParseUint(item, 10, 64)
 			if err != nil {
-				return nil, err
+				return nil, invalidValue(impl.Name, item, "uint")
 			}
 			elem = append(elem, uint(conv))
 		}
@@ -512,7 +968,7 @@ func DurationListFlag(ops ...FlagOption) Flag {
 
 		initial, err := time.ParseDuration(s)
 		if err != nil {
-			return nil, err
+			return nil, invalidValue(impl.Name, s, "duration")
 		}
 
 		elem := make([]time.Duration, 0, 1+len(rem))
@@ -521,7 +977,7 @@ func DurationListFlag(ops ...FlagOption) Flag {
 		for _, item := range rem {
 			conv, err := time.ParseDuration(item)
 			if err != nil {
-				return nil, err
+				return nil, invalidValue(impl.Name, item, "duration")
 			}
 			elem = append(elem, conv)
 		}
@@ -546,18 +1002,18 @@ func IntListFlag(ops ...FlagOption) Flag {
 			}
 		}
 
-		initial, err := strconv.ParseInt(s, 10, 64)
+		initial, err := strconv.ParseInt(s, 0, strconv.IntSize)
 		if err != nil {
-			return nil, err
+			return nil, invalidValue(impl.Name, s, "int")
 		}
 
 		elem := make([]int, 0, 1+len(rem))
 		elem = append(elem, int(initial))
 
 		for _, item := range rem {
-			conv, err := strconv.ParseInt(item, 10, 64)
+			conv, err := strconv.ParseInt(item, 0, strconv.IntSize)
 			if err != nil {
-				return nil, err
+				return nil, invalidValue(impl.Name, item, "int")
 			}
 			elem = append(elem, int(conv))
 		}
@@ -566,6 +1022,29 @@ func IntListFlag(ops ...FlagOption) Flag {
 	return impl
 }
 
+// EnumFlag creates a flag which maps it's string input to the value
+// of the matching key in values, failing for any unknown key.
+func EnumFlag(values map[string]interface{}, ops ...FlagOption) Flag {
+	impl := MakeFlag(ops...)
+	impl.Type = Enum
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	impl.Choices = keys
+
+	impl.Parser = func(s string, rem ...string) (interface{}, error) {
+		value, ok := values[s]
+		if !ok {
+			return nil, fmt.Errorf("flag %q: %q is not one of %s", impl.Name, s, strings.Join(keys, ", "))
+		}
+		return value, nil
+	}
+	return impl
+}
+
 // StringListFlag creates a flag for list of list strings.
 func StringListFlag(ops ...FlagOption) Flag {
 	var impl Flag
@@ -592,94 +1071,257 @@ func StringListFlag(ops ...FlagOption) Flag {
 	return impl
 }
 
-// StringFlag creates a flag for strings.
-func StringFlag(ops ...FlagOption) Flag {
+// EnvVarFlag creates a flag for a list of KEY=VALUE environment
+// variables provided through repeated use of the flag, as in
+// `--env=HOME=/root --env=USER=root`, kept in order for use as the
+// Env of an exec.Cmd.
+func EnvVarFlag(ops ...FlagOption) Flag {
 	var impl Flag
-	impl.Type = String
+	impl.Type = EnvVarList
 	for _, op := range ops {
 		op(&impl)
 	}
 
 	if impl.Default != nil {
-		if _, ok := impl.Default.(string); !ok {
-			log.Fatalf("Flag %q must use type string default value types", impl.Name)
+		if _, ok := impl.Default.([]string); !ok {
+			log.Fatalf("Flag %q must use type []string default value types", impl.Name)
 		}
 	}
 
 	impl.Parser = func(s string, rem ...string) (interface{}, error) {
-		return s, nil
+		if impl.Validation != nil {
+			if err := impl.Validation(s, rem...); err != nil {
+				return nil, err
+			}
+		}
+
+		vars := append([]string{s}, rem...)
+		for _, pair := range vars {
+			if pos := strings.Index(pair, "="); pos < 1 {
+				return nil, fmt.Errorf("flag %q: %q is not a valid KEY=VALUE pair", impl.Name, pair)
+			}
+		}
+		return vars, nil
 	}
 	return impl
 }
 
-// TBoolFlag creates a flag for duration.
-func TBoolFlag(ops ...FlagOption) Flag {
+// SetFlag creates a flag for setting values of a nested map through
+// repeated use of the flag, as in `--set=db.port=5432,db.ssl=true`,
+// where dotted keys address nested maps and values are read as int,
+// float64 or bool when possible, else kept as strings, unless an
+// ElementParser is set.
+func SetFlag(ops ...FlagOption) Flag {
 	var impl Flag
-	impl.Type = TBool
-	impl.Default = true
+	impl.Type = SetMap
 	for _, op := range ops {
 		op(&impl)
 	}
 
 	if impl.Default != nil {
-		if _, ok := impl.Default.(bool); !ok {
-			log.Fatalf("Flag %q must use type bool default value types", impl.Name)
+		if _, ok := impl.Default.(map[string]interface{}); !ok {
+			log.Fatalf("Flag %q must use type map[string]interface{} default value types", impl.Name)
 		}
 	}
 
 	impl.Parser = func(s string, rem ...string) (interface{}, error) {
-		myValue, err := strconv.ParseBool(s)
-		if err != nil {
-			return nil, errors.New("not a bool")
+		if impl.Validation != nil {
+			if err := impl.Validation(s, rem...); err != nil {
+				return nil, err
+			}
 		}
-		return myValue, nil
+
+		values := map[string]interface{}{}
+		for _, item := range append([]string{s}, rem...) {
+			for _, pair := range strings.Split(item, ",") {
+				pos := strings.Index(pair, "=")
+				if pos < 1 {
+					return nil, fmt.Errorf("flag %q: %q is not a valid key=value pair", impl.Name, pair)
+				}
+				value := inferValue(pair[pos+1:])
+				if impl.ElementParser != nil {
+					parsed, err := impl.ElementParser(pair[pos+1:])
+					if err != nil {
+						return nil, err
+					}
+					value = parsed
+				}
+				if err := setNested(values, strings.Split(pair[:pos], "."), value); err != nil {
+					return nil, fmt.Errorf("flag %q: %s", impl.Name, err)
+				}
+			}
+		}
+		return values, nil
 	}
 	return impl
 }
 
-// BoolFlag creates a flag for duration.
-func BoolFlag(ops ...FlagOption) Flag {
+// HeaderFlag creates a flag for HTTP headers provided through repeated
+// use of the flag, as in `--header="Accept: text/plain"` or
+// `--header=Accept=text/plain`, with canonical header names, where
+// repeated names add values to the header.
+func HeaderFlag(ops ...FlagOption) Flag {
 	var impl Flag
-	impl.Type = Bool
-	impl.Default = false
+	impl.Type = HeaderMap
 	for _, op := range ops {
 		op(&impl)
 	}
 
 	if impl.Default != nil {
-		if _, ok := impl.Default.(bool); !ok {
-			log.Fatalf("Flag %q must use type bool default value types", impl.Name)
+		if _, ok := impl.Default.(http.Header); !ok {
+			log.Fatalf("Flag %q must use type http.Header default value types", impl.Name)
 		}
 	}
 
 	impl.Parser = func(s string, rem ...string) (interface{}, error) {
-		myValue, err := strconv.ParseBool(s)
-		if err != nil {
-			return nil, errors.New("not a bool")
+		if impl.Validation != nil {
+			if err := impl.Validation(s, rem...); err != nil {
+				return nil, err
+			}
 		}
-		return myValue, nil
+
+		header := http.Header{}
+		for _, item := range append([]string{s}, rem...) {
+			pos := strings.IndexAny(item, ":=")
+			if pos < 1 {
+				return nil, fmt.Errorf("flag %q: %q is not a valid Name: value header", impl.Name, item)
+			}
+			header.Add(strings.TrimSpace(item[:pos]), strings.TrimSpace(item[pos+1:]))
+		}
+		return header, nil
 	}
 	return impl
 }
 
-// DurationFlag creates a flag for duration.
-func DurationFlag(ops ...FlagOption) Flag {
+// setNested sets giving value at the path of keys within values,
+// creating the nested maps along the path.
+func setNested(values map[string]interface{}, path []string, value interface{}) error {
+	for i, key := range path[:len(path)-1] {
+		next, ok := values[key].(map[string]interface{})
+		if !ok {
+			if _, exists := values[key]; exists {
+				return fmt.Errorf("%q is not a map", strings.Join(path[:i+1], "."))
+			}
+			next = map[string]interface{}{}
+			values[key] = next
+		}
+		values = next
+	}
+	values[path[len(path)-1]] = value
+	return nil
+}
+
+// decimalPattern matches decimal number literals, unlike ParseFloat
+// which also accepts words such as "inf" and "nan".
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// inferValue returns giving value as an int, float64 or bool if it
+// represents one, else as is.
+func inferValue(value string) interface{} {
+	if number, err := strconv.Atoi(value); err == nil {
+		return number
+	}
+	if decimalPattern.MatchString(value) {
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			return number
+		}
+	}
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+	return value
+}
+
+// StringFlag creates a flag for strings.
+func StringFlag(ops ...FlagOption) Flag {
 	var impl Flag
-	impl.Type = Duration
+	impl.Type = String
 	for _, op := range ops {
 		op(&impl)
 	}
 
 	if impl.Default != nil {
-		if _, ok := impl.Default.(time.Duration); !ok {
-			log.Fatalf("Flag %q must use type time.Duration default value types", impl.Name)
+		if _, ok := impl.Default.(string); !ok {
+			log.Fatalf("Flag %q must use type string default value types", impl.Name)
 		}
 	}
 
 	impl.Parser = func(s string, rem ...string) (interface{}, error) {
-		myValue, err := time.ParseDuration(s)
+		return s, nil
+	}
+	return impl
+}
+
+// TBoolFlag creates a flag for duration.
+func TBoolFlag(ops ...FlagOption) Flag {
+	var impl Flag
+	impl.Type = TBool
+	impl.Default = true
+	impl.NoValue = true
+	for _, op := range ops {
+		op(&impl)
+	}
+
+	if impl.Default != nil {
+		if _, ok := impl.Default.(bool); !ok {
+			log.Fatalf("Flag %q must use type bool default value types", impl.Name)
+		}
+	}
+
+	impl.Parser = func(s string, rem ...string) (interface{}, error) {
+		myValue, err := strconv.ParseBool(s)
 		if err != nil {
-			return nil, err
+			return nil, invalidValue(impl.Name, s, "bool")
+		}
+		return myValue, nil
+	}
+	return impl
+}
+
+// BoolFlag creates a flag for duration.
+func BoolFlag(ops ...FlagOption) Flag {
+	var impl Flag
+	impl.Type = Bool
+	impl.Default = false
+	impl.NoValue = true
+	for _, op := range ops {
+		op(&impl)
+	}
+
+	if impl.Default != nil {
+		if _, ok := impl.Default.(bool); !ok {
+			log.Fatalf("Flag %q must use type bool default value types", impl.Name)
+		}
+	}
+
+	impl.Parser = func(s string, rem ...string) (interface{}, error) {
+		myValue, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, invalidValue(impl.Name, s, "bool")
+		}
+		return myValue, nil
+	}
+	return impl
+}
+
+// DurationFlag creates a flag for duration.
+func DurationFlag(ops ...FlagOption) Flag {
+	var impl Flag
+	impl.Type = Duration
+	for _, op := range ops {
+		op(&impl)
+	}
+
+	if impl.Default != nil {
+		if _, ok := impl.Default.(time.Duration); !ok {
+			log.Fatalf("Flag %q must use type time.Duration default value types", impl.Name)
+		}
+	}
+
+	impl.Parser = func(s string, rem ...string) (interface{}, error) {
+		myValue, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, invalidValue(impl.Name, s, "duration")
 		}
 		return myValue, nil
 	}
@@ -701,9 +1343,9 @@ func Int8Flag(ops ...FlagOption) Flag {
 	}
 
 	impl.Parser = func(s string, rem ...string) (interface{}, error) {
-		myValue, err := strconv.ParseInt(s, 10, 8)
+		myValue, err := strconv.ParseInt(s, 0, 8)
 		if err != nil {
-			return nil, errors.New("not a int8")
+			return nil, invalidValue(impl.Name, s, "int8")
 		}
 		return int8(myValue), nil
 	}
@@ -725,9 +1367,9 @@ func Int16Flag(ops ...FlagOption) Flag {
 	}
 
 	impl.Parser = func(s string, rem ...string) (interface{}, error) {
-		myValue, err := strconv.ParseInt(s, 10, 16)
+		myValue, err := strconv.ParseInt(s, 0, 16)
 		if err != nil {
-			return nil, err
+			return nil, invalidValue(impl.Name, s, "int16")
 		}
 		return int16(myValue), nil
 	}
@@ -737,7 +1379,7 @@ func Int16Flag(ops ...FlagOption) Flag {
 // UInt64Flag creates a flag for int.
 func UInt64Flag(ops ...FlagOption) Flag {
 	var impl Flag
-	impl.Type = UInt
+	impl.Type = UInt64
 	for _, op := range ops {
 		op(&impl)
 	}
@@ -751,13 +1393,85 @@ func UInt64Flag(ops ...FlagOption) Flag {
 	impl.Parser = func(s string, rem ...string) (interface{}, error) {
 		myValue, err := strconv.ParseUint(s, 10, 64)
 		if err != nil {
-			return nil, errors.New("not a uint64")
+			return nil, invalidValue(impl.Name, s, "uint64")
 		}
 		return myValue, nil
 	}
 	return impl
 }
 
+// UInt8Flag creates a flag for uint8.
+func UInt8Flag(ops ...FlagOption) Flag {
+	var impl Flag
+	impl.Type = UInt8
+	for _, op := range ops {
+		op(&impl)
+	}
+
+	if impl.Default != nil {
+		if _, ok := impl.Default.(uint8); !ok {
+			log.Fatalf("Flag %q must use type uint8 default value types", impl.Name)
+		}
+	}
+
+	impl.Parser = func(s string, rem ...string) (interface{}, error) {
+		myValue, err := strconv.ParseUint(s, 10, 8)
+		if err != nil {
+			return nil, invalidValue(impl.Name, s, "uint8")
+		}
+		return uint8(myValue), nil
+	}
+	return impl
+}
+
+// UInt16Flag creates a flag for uint16.
+func UInt16Flag(ops ...FlagOption) Flag {
+	var impl Flag
+	impl.Type = UInt16
+	for _, op := range ops {
+		op(&impl)
+	}
+
+	if impl.Default != nil {
+		if _, ok := impl.Default.(uint16); !ok {
+			log.Fatalf("Flag %q must use type uint16 default value types", impl.Name)
+		}
+	}
+
+	impl.Parser = func(s string, rem ...string) (interface{}, error) {
+		myValue, err := strconv.ParseUint(s, 10, 16)
+		if err != nil {
+			return nil, invalidValue(impl.Name, s, "uint16")
+		}
+		return uint16(myValue), nil
+	}
+	return impl
+}
+
+// UInt32Flag creates a flag for uint32.
+func UInt32Flag(ops ...FlagOption) Flag {
+	var impl Flag
+	impl.Type = UInt32
+	for _, op := range ops {
+		op(&impl)
+	}
+
+	if impl.Default != nil {
+		if _, ok := impl.Default.(uint32); !ok {
+			log.Fatalf("Flag %q must use type uint32 default value types", impl.Name)
+		}
+	}
+
+	impl.Parser = func(s string, rem ...string) (interface{}, error) {
+		myValue, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, invalidValue(impl.Name, s, "uint32")
+		}
+		return uint32(myValue), nil
+	}
+	return impl
+}
+
 // UIntFlag creates a flag for int.
 func UIntFlag(ops ...FlagOption) Flag {
 	var impl Flag
@@ -775,7 +1489,7 @@ func UIntFlag(ops ...FlagOption) Flag {
 	impl.Parser = func(s string, rem ...string) (interface{}, error) {
 		myValue, err := strconv.ParseUint(s, 10, 64)
 		if err != nil {
-			return nil, errors.New("not a uint")
+			return nil, invalidValue(impl.Name, s, "uint")
 		}
 		return uint(myValue), nil
 	}
@@ -797,11 +1511,11 @@ func IntFlag(ops ...FlagOption) Flag {
 	}
 
 	impl.Parser = func(s string, rem ...string) (interface{}, error) {
-		myValue, err := strconv.Atoi(s)
+		myValue, err := strconv.ParseInt(s, 0, strconv.IntSize)
 		if err != nil {
-			return nil, err
+			return nil, invalidValue(impl.Name, s, "int")
 		}
-		return myValue, nil
+		return int(myValue), nil
 	}
 	return impl
 }
@@ -823,13 +1537,68 @@ func Float64Flag(ops ...FlagOption) Flag {
 	impl.Parser = func(s string, rem ...string) (interface{}, error) {
 		myValue, err := strconv.ParseFloat(s, 64)
 		if err != nil {
-			return nil, err
+			return nil, invalidValue(impl.Name, s, "float64")
 		}
 		return myValue, nil
 	}
 	return impl
 }
 
+// UnitRegistry maps the unit suffixes of values, such as "qps" or
+// "MB", to the multiplier converting a value of the unit into the
+// number stored for it.
+type UnitRegistry map[string]float64
+
+// ByteUnits is a UnitRegistry of decimal and binary byte sizes,
+// converting values such as 5MB or 2GiB into bytes.
+var ByteUnits = UnitRegistry{
+	"B":   1,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// UnitFlag creates a flag for float64 values with a unit suffix from
+// giving registry, as in `--rate=5qps`, storing the number multiplied
+// by the multiplier of the unit. Values without a unit are stored as is.
+func UnitFlag(registry UnitRegistry, ops ...FlagOption) Flag {
+	impl := Float64Flag(ops...)
+
+	units := make([]string, 0, len(registry))
+	for unit := range registry {
+		units = append(units, unit)
+	}
+	// longer units are matched first, such that "MiB" isn't read as "B".
+	sort.Slice(units, func(i, j int) bool {
+		if len(units[i]) != len(units[j]) {
+			return len(units[i]) > len(units[j])
+		}
+		return units[i] < units[j]
+	})
+
+	impl.Parser = func(s string, rem ...string) (interface{}, error) {
+		number, multiplier := strings.TrimSpace(s), 1.0
+		for _, unit := range units {
+			if unit != "" && strings.HasSuffix(number, unit) {
+				number, multiplier = strings.TrimSpace(strings.TrimSuffix(number, unit)), registry[unit]
+				break
+			}
+		}
+
+		value, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return nil, fmt.Errorf("flag %q: %q is not a number with one of units %s", impl.Name, s, strings.Join(units, ", "))
+		}
+		return value * multiplier, nil
+	}
+	return impl
+}
+
 // Float32Flag creates a flag for int.
 func Float32Flag(ops ...FlagOption) Flag {
 	var impl Flag
@@ -847,7 +1616,7 @@ func Float32Flag(ops ...FlagOption) Flag {
 	impl.Parser = func(s string, rem ...string) (interface{}, error) {
 		myValue, err := strconv.ParseFloat(s, 32)
 		if err != nil {
-			return nil, err
+			return nil, invalidValue(impl.Name, s, "float32")
 		}
 		return float32(myValue), nil
 	}
@@ -869,9 +1638,9 @@ func Int64Flag(ops ...FlagOption) Flag {
 	}
 
 	impl.Parser = func(s string, rem ...string) (interface{}, error) {
-		myValue, err := strconv.ParseInt(s, 10, 64)
+		myValue, err := strconv.ParseInt(s, 0, 64)
 		if err != nil {
-			return nil, err
+			return nil, invalidValue(impl.Name, s, "int64")
 		}
 		return myValue, nil
 	}
@@ -893,9 +1662,9 @@ func Int32Flag(ops ...FlagOption) Flag {
 	}
 
 	impl.Parser = func(s string, rem ...string) (interface{}, error) {
-		myValue, err := strconv.ParseInt(s, 10, 32)
+		myValue, err := strconv.ParseInt(s, 0, 32)
 		if err != nil {
-			return nil, err
+			return nil, invalidValue(impl.Name, s, "int32")
 		}
 		return int32(myValue), nil
 	}
@@ -911,12 +1680,22 @@ type KeyValue interface {
 	IsSet(string) bool
 	Int(string) int
 	Bool(string) bool
+	BoolSet(string) (bool, bool)
 	Uint(string) uint
 	Uint64(string) uint64
+	Uint8(string) uint8
+	Uint16(string) uint16
+	Uint32(string) uint32
 	Int64(string) int64
 	String(string) string
+	Raw(string) string
+	StringSliceUnique(string) []string
+	Joined(string, string) string
+	Nested(string) map[string]interface{}
+	Header(string) http.Header
 	Float64(string) float64
 	Duration(string) time.Duration
+	Enum(string) interface{}
 	Get(string) (interface{}, bool)
 }
 
@@ -926,18 +1705,73 @@ type Context interface {
 	KeyValue
 
 	PrintHelp()
+	Stdout() io.Writer
+	Stderr() io.Writer
+	IsTerminal() bool
+	DryRun() bool
+	Quiet() bool
+	Render(interface{}) error
+	Printf(string, ...interface{})
+	Println(...interface{})
+	Getenv(string) string
+	LookupEnv(string) (string, bool)
+	Command() *Command
+	CommandPath() []string
+	Argv() *argv.Argv
 	Args() []string
+	ArgInt(int) (int, error)
+	ArgInt64(int) (int64, error)
+	ArgFloat64(int) (float64, error)
+	ArgBool(int) (bool, error)
+	ArgDuration(int) (time.Duration, error)
+	Remainder() []string
+	UnknownFlags() []string
+	Require(...string) error
+	Cancel()
+	WithValue(key, value interface{}) Context
+	WithTimeout(time.Duration) (Context, context.CancelFunc)
 	Parent() KeyValue
 	Ctx() context.Context
 }
 
 type ctxImpl struct {
 	ctx         context.Context
+	cancel      context.CancelFunc
 	args        []string
 	HelpPrinter func()
 	parent      Context
+	path        []string
+	conf        *runConfig
+	command     *Command
+	raw         *argv.Argv
+	stdout      io.Writer
+	stderr      io.Writer
+	env         map[string]string
 	flags       map[string]struct{}
 	pairs       map[string]interface{}
+	sources     map[string]string
+	raws        map[string]string
+	fileFlags   map[string]struct{}
+	eager       bool
+}
+
+// inherit copies the run configuration and command path of giving
+// parent context if it was created by Run.
+func (c *ctxImpl) inherit(parent Context, name string) {
+	c.conf = runConfigOf(parent)
+	if pc, ok := parent.(*ctxImpl); ok {
+		c.path = append(c.path, pc.path...)
+	}
+	c.path = append(c.path, name)
+}
+
+// runConfigOf returns the run configuration of giving context if it
+// was created by Run, else a default configuration.
+func runConfigOf(ctx Context) *runConfig {
+	if c, ok := ctx.(*ctxImpl); ok && c.conf != nil {
+		return c.conf
+	}
+	return &runConfig{metrics: noopMetrics{}, keyring: noopKeyring{}}
 }
 
 // Args returning the internal associated arg list.
@@ -946,11 +1780,185 @@ func (c ctxImpl) Args() []string {
 	return c.args
 }
 
+// arg returns the positional argument at giving index, returning an
+// error if the command received fewer arguments.
+func (c ctxImpl) arg(index int) (string, error) {
+	if index < 0 || index >= len(c.args) {
+		return "", fmt.Errorf("missing argument %d, got %d arguments", index+1, len(c.args))
+	}
+	return c.args[index], nil
+}
+
+// ArgInt returns the positional argument at giving index as an int,
+// returning an error if it is missing or not a valid int. Base prefixes
+// such as 0x are accepted, as for int flags.
+func (c ctxImpl) ArgInt(index int) (int, error) {
+	value, err := c.arg(index)
+	if err != nil {
+		return 0, err
+	}
+	number, err := strconv.ParseInt(value, 0, strconv.IntSize)
+	if err != nil {
+		return 0, fmt.Errorf("argument %d: %q is not a valid int", index+1, value)
+	}
+	return int(number), nil
+}
+
+// ArgInt64 returns the positional argument at giving index as an int64,
+// returning an error if it is missing or not a valid int64.
+func (c ctxImpl) ArgInt64(index int) (int64, error) {
+	value, err := c.arg(index)
+	if err != nil {
+		return 0, err
+	}
+	number, err := strconv.ParseInt(value, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("argument %d: %q is not a valid int64", index+1, value)
+	}
+	return number, nil
+}
+
+// ArgFloat64 returns the positional argument at giving index as a
+// float64, returning an error if it is missing or not a valid float64.
+func (c ctxImpl) ArgFloat64(index int) (float64, error) {
+	value, err := c.arg(index)
+	if err != nil {
+		return 0, err
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("argument %d: %q is not a valid float64", index+1, value)
+	}
+	return number, nil
+}
+
+// ArgBool returns the positional argument at giving index as a bool,
+// returning an error if it is missing or not a valid bool.
+func (c ctxImpl) ArgBool(index int) (bool, error) {
+	value, err := c.arg(index)
+	if err != nil {
+		return false, err
+	}
+	truth, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("argument %d: %q is not a valid bool", index+1, value)
+	}
+	return truth, nil
+}
+
+// ArgDuration returns the positional argument at giving index as a
+// time.Duration, returning an error if it is missing or not a valid
+// duration.
+func (c ctxImpl) ArgDuration(index int) (time.Duration, error) {
+	value, err := c.arg(index)
+	if err != nil {
+		return 0, err
+	}
+	dur, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("argument %d: %q is not a valid time.Duration", index+1, value)
+	}
+	return dur, nil
+}
+
+// Command returns the command which is currently being executed.
+func (c ctxImpl) Command() *Command {
+	return c.command
+}
+
+// CommandPath returns the names of the commands leading to the command
+// being executed, starting with the top level command.
+func (c ctxImpl) CommandPath() []string {
+	return append([]string(nil), c.path...)
+}
+
+// Argv returns the parsed argv.Argv of the command, providing access to
+// flags not declared by the command and the raw positional text.
+func (c ctxImpl) Argv() *argv.Argv {
+	return c.raw
+}
+
+// UnknownFlags returns the sorted names of the flags provided to the
+// command which were declared neither by the command nor its parents,
+// and were thereby ignored.
+func (c ctxImpl) UnknownFlags() []string {
+	if c.raw == nil {
+		return nil
+	}
+
+	var unknown []string
+	for key := range c.raw.Pairs {
+		if !c.declared(key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// declared returns true/false if giving key names a flag of the context
+// or any of its parents.
+func (c ctxImpl) declared(key string) bool {
+	if _, ok := c.flags[key]; ok {
+		return true
+	}
+	if parent, ok := c.parent.(*ctxImpl); ok {
+		return parent.declared(key)
+	}
+	return false
+}
+
+// Remainder returns the arguments which followed the `--` terminator
+// of the command, left untouched by the parser.
+func (c ctxImpl) Remainder() []string {
+	if c.raw == nil {
+		return nil
+	}
+	return c.raw.Remainder
+}
+
 // Ctx returns the context.Context associated with the command context.
 func (c ctxImpl) Ctx() context.Context {
 	return c.ctx
 }
 
+// WithValue returns a copy of the context carrying giving value, which
+// is visible through Get and Ctx to the context and all contexts of
+// its sub commands.
+func (c ctxImpl) WithValue(key, value interface{}) Context {
+	parent := c.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	c.ctx = context.WithValue(parent, key, value)
+	return &c
+}
+
+// WithTimeout returns a copy of the context whose context.Context
+// expires after giving duration, for bounding a sub operation of a
+// command without affecting the context of the command.
+func (c ctxImpl) WithTimeout(d time.Duration) (Context, context.CancelFunc) {
+	parent := c.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	var cancel context.CancelFunc
+	c.ctx, cancel = context.WithTimeout(parent, d)
+	return &c, cancel
+}
+
+// Cancel cancels the root context.Context from which the context of
+// every command is derived.
+func (c ctxImpl) Cancel() {
+	if c.cancel != nil {
+		c.cancel()
+		return
+	}
+	if c.parent != nil {
+		c.parent.Cancel()
+	}
+}
+
 // Parent returns a Context that is the context of
 // a parent command in relation to the command that
 // generated this context.
@@ -965,6 +1973,96 @@ func (c ctxImpl) PrintHelp() {
 	}
 }
 
+// Stdout returns the standard output of the command.
+func (c ctxImpl) Stdout() io.Writer {
+	if c.stdout == nil {
+		return os.Stdout
+	}
+	return c.stdout
+}
+
+// Stderr returns the standard error of the command.
+func (c ctxImpl) Stderr() io.Writer {
+	if c.stderr == nil {
+		return os.Stderr
+	}
+	return c.stderr
+}
+
+// DryRun returns true/false if the built-in dry-run flag was set for
+// the command or any of its parents, in which case the command should
+// skip any side effects. Programs declaring their own dry-run flag
+// replace the built-in one, which is then never set.
+func (c *ctxImpl) DryRun() bool {
+	return c.builtinBool("dry-run")
+}
+
+// Quiet returns true/false if the built-in quiet flag was set for the
+// command or any of its parents, in which case Printf and Println write
+// nothing, while writes to Stderr still occur. Programs declaring their
+// own quiet or q flag replace the built-in one, which is then never set.
+func (c *ctxImpl) Quiet() bool {
+	return c.builtinBool("quiet")
+}
+
+// builtinBool returns the value of giving built-in bool flag, being
+// false when a flag declared by the program shadows the built-in one.
+func (c *ctxImpl) builtinBool(name string) bool {
+	for _, flag := range runConfigOf(c).builtins {
+		if flag.FlagName() == name {
+			return c.Bool(name)
+		}
+	}
+	return false
+}
+
+// IsTerminal returns true/false if the standard output of the command
+// is a terminal, allowing commands to switch between human and machine
+// readable output.
+func (c ctxImpl) IsTerminal() bool {
+	file, ok := c.Stdout().(*os.File)
+	return ok && isTerminal(file)
+}
+
+// Printf writes the formatted text to the standard output of the
+// command, unless the quiet flag was set.
+func (c ctxImpl) Printf(format string, args ...interface{}) {
+	if c.Quiet() {
+		return
+	}
+	fmt.Fprintf(c.Stdout(), format, args...)
+}
+
+// Println writes the giving values with a newline to the standard
+// output of the command, unless the quiet flag was set.
+func (c ctxImpl) Println(args ...interface{}) {
+	if c.Quiet() {
+		return
+	}
+	fmt.Fprintln(c.Stdout(), args...)
+}
+
+// Getenv returns the value of the environment variable named by the key,
+// checking the environment set on the command and its parents before the
+// process environment.
+func (c ctxImpl) Getenv(key string) string {
+	value, _ := c.LookupEnv(key)
+	return value
+}
+
+// LookupEnv returns the value of the environment variable named by the key
+// and true/false if it was found, checking the environment set on the
+// command and its parents before the process environment and .env files.
+func (c ctxImpl) LookupEnv(key string) (string, bool) {
+	if value, ok := c.env[key]; ok {
+		return value, true
+	}
+	if c.parent == nil {
+		return runConfigOf(&c).lookupEnv(key)
+	}
+	return c.parent.LookupEnv(key)
+}
+
 // Duration returns the duration value of a key if it exists.
 func (c *ctxImpl) Duration(key string) time.Duration {
 	if val, found := c.Get(key); found {
@@ -973,6 +2071,14 @@ func (c *ctxImpl) Duration(key string) time.Duration {
 	return 0
 }
 
+// Enum returns the mapped value of a enum key if it exists.
+func (c *ctxImpl) Enum(key string) interface{} {
+	if val, found := c.Get(key); found {
+		return val
+	}
+	return nil
+}
+
 // Bool returns the bool value of a key if it exists.
 func (c *ctxImpl) Bool(key string) bool {
 	if val, found := c.Get(key); found {
@@ -981,6 +2087,13 @@ func (c *ctxImpl) Bool(key string) bool {
 	return false
 }
 
+// BoolSet returns the bool value of a key with true/false if the value
+// was explicitly provided through argument or environment, rather than
+// being the default.
+func (c *ctxImpl) BoolSet(key string) (bool, bool) {
+	return c.Bool(key), c.provided(key)
+}
+
 // Float64 returns the float64 value of a key if it exists.
 func (c *ctxImpl) Float64(key string) float64 {
 	if val, found := c.Get(key); found {
@@ -1037,267 +2150,2101 @@ func (c *ctxImpl) Uint64(key string) uint64 {
 	return 0
 }
 
-// Uint returns the value type value of a key if it exists.
-func (c *ctxImpl) Uint(key string) uint {
+// Uint8 returns the uint8 value of a key if it exists.
+func (c *ctxImpl) Uint8(key string) uint8 {
 	if val, found := c.Get(key); found {
-		return val.(uint)
+		return val.(uint8)
 	}
 	return 0
 }
 
-// Int returns the value type value of a key if it exists.
+// Uint16 returns the uint16 value of a key if it exists.
+func (c *ctxImpl) Uint16(key string) uint16 {
+	if val, found := c.Get(key); found {
+		return val.(uint16)
+	}
+	return 0
+}
+
+// Uint32 returns the uint32 value of a key if it exists.
+func (c *ctxImpl) Uint32(key string) uint32 {
+	if val, found := c.Get(key); found {
+		return val.(uint32)
+	}
+	return 0
+}
+
+// Uint returns the value type value of a key if it exists.
+func (c *ctxImpl) Uint(key string) uint {
+	if val, found := c.Get(key); found {
+		return val.(uint)
+	}
+	return 0
+}
+
+// Int returns the value type value of a key if it exists.
 func (c *ctxImpl) Int(key string) int {
 	if val, found := c.Get(key); found {
 		return val.(int)
 	}
-	return 0
+	return 0
+}
+
+// String returns the value type value of a key if it exists.
+func (c *ctxImpl) String(key string) string {
+	if val, found := c.Get(key); found {
+		return val.(string)
+	}
+	return ""
+}
+
+// Raw returns the string a key was resolved from before parsing, being
+// the provided argument, environment or config value, or the default
+// formatted as a string. Multiple values are joined by commas.
+func (c *ctxImpl) Raw(key string) string {
+	if raw, ok := c.raws[key]; ok {
+		return raw
+	}
+	if parent, ok := c.parent.(*ctxImpl); ok {
+		return parent.Raw(key)
+	}
+	return ""
+}
+
+// StringSliceUnique returns the []string value of a key if it exists,
+// in input order with duplicates removed, keeping the first occurrence.
+func (c *ctxImpl) StringSliceUnique(key string) []string {
+	val, found := c.Get(key)
+	if !found {
+		return nil
+	}
+
+	items := val.([]string)
+	seen := make(map[string]struct{}, len(items))
+	unique := make([]string, 0, len(items))
+	for _, item := range items {
+		if _, ok := seen[item]; ok {
+			continue
+		}
+		seen[item] = struct{}{}
+		unique = append(unique, item)
+	}
+	return unique
+}
+
+// Joined returns the elements of the list value of a key joined by
+// giving separator, as for PATH like values, returning an empty string
+// if the key is not set.
+func (c *ctxImpl) Joined(key string, sep string) string {
+	val, found := c.Get(key)
+	if !found {
+		return ""
+	}
+	if items, ok := val.([]string); ok {
+		return strings.Join(items, sep)
+	}
+
+	list := reflect.ValueOf(val)
+	if list.Kind() != reflect.Slice {
+		return fmt.Sprint(val)
+	}
+	items := make([]string, list.Len())
+	for index := range items {
+		items[index] = fmt.Sprint(list.Index(index).Interface())
+	}
+	return strings.Join(items, sep)
+}
+
+// Nested returns the map value of a key if it exists, as set by
+// a SetFlag.
+func (c *ctxImpl) Nested(key string) map[string]interface{} {
+	if val, found := c.Get(key); found {
+		return val.(map[string]interface{})
+	}
+	return nil
+}
+
+// Header returns the http.Header value of a key if it exists, as set
+// by a HeaderFlag.
+func (c *ctxImpl) Header(key string) http.Header {
+	if val, found := c.Get(key); found {
+		return val.(http.Header)
+	}
+	return nil
+}
+
+// Get returns the value of a key if it exists.
+// If the key is not seen within present context, then the parent
+// of context is checked for giving key.
+func (c *ctxImpl) Get(key string) (value interface{}, found bool) {
+	if item, ok := c.pairs[key]; ok {
+		return item, true
+	}
+	if c.ctx != nil {
+		if item := c.ctx.Value(key); item != nil {
+			return item, true
+		}
+	}
+	if c.parent == nil {
+		return nil, false
+	}
+	return c.parent.Get(key)
+}
+
+// IsSet returns true/false if giving key was set in command context.
+func (c *ctxImpl) IsSet(key string) bool {
+	if _, ok := c.pairs[key]; ok {
+		return true
+	}
+	return false
+}
+
+// Require returns an error listing all of giving flags which were not
+// provided to the command or any of its parents, allowing actions to
+// require flags only needed by some of their uses.
+func (c *ctxImpl) Require(names ...string) error {
+	var missing []string
+	for _, name := range names {
+		if !c.provided(name) {
+			missing = append(missing, "--"+name)
+		}
+	}
+
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("command %q: flag %s must be provided", c.command.Name, missing[0])
+	default:
+		return fmt.Errorf("command %q: flags %s must be provided", c.command.Name, strings.Join(missing, ", "))
+	}
+}
+
+// provided returns true/false if giving key was set through argument
+// or environment in the context or any of its parents.
+func (c *ctxImpl) provided(key string) bool {
+	if source, ok := c.sources[key]; ok {
+		return source != SourceDefault
+	}
+	if source, ok := c.parentSource(key); ok {
+		return source != SourceDefault
+	}
+	return false
+}
+
+// checkExactlyOne returns an error if any of giving groups does not
+// have exactly one of its flags provided.
+func (c *ctxImpl) checkExactlyOne(groups [][]string) error {
+	for _, group := range groups {
+		var set []string
+		for _, name := range group {
+			if c.provided(name) {
+				set = append(set, "--"+name)
+			}
+		}
+
+		switch len(set) {
+		case 1:
+			continue
+		case 0:
+			return fmt.Errorf("exactly one of flags --%s must be provided", strings.Join(group, ", --"))
+		default:
+			return fmt.Errorf("only one of flags --%s can be provided, got %s", strings.Join(group, ", --"), strings.Join(set, ", "))
+		}
+	}
+	return nil
+}
+
+// checkExclusive returns an error if more than one flag of any of
+// giving groups was provided.
+func (c *ctxImpl) checkExclusive(groups [][]string) error {
+	for _, group := range groups {
+		var set []string
+		for _, name := range group {
+			if c.provided(name) {
+				set = append(set, "--"+name)
+			}
+		}
+
+		if len(set) > 1 {
+			last := len(set) - 1
+			return fmt.Errorf("flags %s and %s are mutually exclusive", strings.Join(set[:last], ", "), set[last])
+		}
+	}
+	return nil
+}
+
+func (c *ctxImpl) process(arg *argv.Argv, flags []Flag) error {
+	if c.pairs == nil {
+		c.flags = map[string]struct{}{}
+		c.pairs = map[string]interface{}{}
+		c.sources = map[string]string{}
+		c.raws = map[string]string{}
+	}
+
+	var errs []error
+	var pending []Flag
+	for _, flag := range flags {
+		deferred, err := c.processFlag(arg, flag)
+		if err != nil && !c.eager {
+			return err
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if deferred {
+			pending = append(pending, flag)
+		}
+	}
+
+	if err := c.processDefaultFrom(pending); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.checkRequired(flags); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// checkRequired returns an error listing all of giving required flags
+// which were not resolved in the context or any of its parents.
+func (c *ctxImpl) checkRequired(flags []Flag) error {
+	var missing []string
+	for _, flag := range flags {
+		if !flag.Required {
+			continue
+		}
+		if _, ok := c.sources[flag.FlagName()]; ok {
+			continue
+		}
+		if _, ok := c.parentSource(flag.FlagName()); ok {
+			continue
+		}
+		missing = append(missing, "--"+flag.FlagName())
+	}
+
+	prefix := ""
+	if c.command != nil {
+		prefix = fmt.Sprintf("command %q: ", c.command.Name)
+	}
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%srequired flag %s was not provided", prefix, missing[0])
+	default:
+		return fmt.Errorf("%srequired flags %s were not provided", prefix, strings.Join(missing, ", "))
+	}
+}
+
+// processFlag resolves the value of giving flag from the provided
+// arguments, environment, config or default, returning true if the
+// flag defaults to another flag and must be resolved after it.
+func (c *ctxImpl) processFlag(arg *argv.Argv, flag Flag) (bool, error) {
+	c.flags[c.flagKey(flag.FlagName())] = struct{}{}
+	c.flags[c.flagKey(flag.FlagAlias())] = struct{}{}
+	key := c.flagKey(flag.FlagName())
+	flagValue, provided := arg.Pairs[key]
+	if !provided && flag.FlagAlias() != "" {
+		key = c.flagKey(flag.FlagAlias())
+		flagValue, provided = arg.Pairs[key]
+	}
+	if provided {
+		source := SourceFlag
+		if _, ok := c.fileFlags[key]; ok {
+			source = SourceFile
+		}
+		// repeated flags of a single value take the last value provided.
+		if !flag.Type.accumulates() {
+			flagValue = flagValue[len(flagValue)-1:]
+		}
+		flagValue, err := c.expand(flag, flagValue, source)
+		if err != nil {
+			return false, err
+		}
+		value, err := flag.Parse(flagValue[0], flagValue[1:]...)
+		if err != nil {
+			return false, err
+		}
+		return false, c.set(flag, value, strings.Join(flagValue, ","), source)
+	}
+	if envValue, ok := c.LookupEnv(flag.Env); flag.Env != "" && ok {
+		envValues, err := c.expand(flag, []string{envValue}, SourceEnv)
+		if err != nil {
+			return false, err
+		}
+		envValue = envValues[0]
+		value, err := flag.Parse(envValue)
+		if err != nil {
+			return false, err
+		}
+		return false, c.set(flag, value, envValue, SourceEnv)
+	}
+	if flag.Keyring != "" {
+		secret, err := c.conf.keyring.Get(flag.Keyring, flag.FlagName())
+		if err != nil && !errors.Is(err, ErrSecretNotFound) && !errors.Is(err, ErrKeyringUnavailable) {
+			return false, fmt.Errorf("flag %q: reading keyring: %s", flag.FlagName(), err)
+		}
+		if err == nil {
+			value, err := flag.Parse(secret)
+			if err != nil {
+				return false, err
+			}
+			return false, c.set(flag, value, secret, SourceKeyring)
+		}
+	}
+	if configValue, ok := lookupConfig(c.conf.config, c.path, flag.FlagName()); ok {
+		configValue, err := c.expand(flag, configValue, SourceConfig)
+		if err != nil {
+			return false, err
+		}
+		value, err := flag.Parse(configValue[0], configValue[1:]...)
+		if err != nil {
+			return false, err
+		}
+		return false, c.set(flag, value, strings.Join(configValue, ","), SourceConfig)
+	}
+	// a default only shadows the value of a parent's flag of the
+	// same name when that value is also a default.
+	if source, ok := c.parentSource(flag.FlagName()); ok && source != SourceDefault {
+		return false, nil
+	}
+	if flag.DefaultFrom != "" {
+		return true, nil
+	}
+	if flag.DefaultValue() != nil {
+		return false, c.set(flag, flag.DefaultValue(), rawDefault(flag.DefaultValue()), SourceDefault)
+	}
+	return false, nil
+}
+
+// rawDefault returns giving default value formatted as a string, with
+// the items of lists joined by commas as provided in arguments.
+func rawDefault(value interface{}) string {
+	list := reflect.ValueOf(value)
+	if list.Kind() != reflect.Slice {
+		return fmt.Sprint(value)
+	}
+	items := make([]string, list.Len())
+	for index := range items {
+		items[index] = fmt.Sprint(list.Index(index).Interface())
+	}
+	return strings.Join(items, ",")
+}
+
+// processDefaultFrom sets the flags defaulting to the value of another
+// flag once the other flag is resolved, in as many passes as needed for
+// flags defaulting to each other in chain.
+func (c *ctxImpl) processDefaultFrom(pending []Flag) error {
+	for len(pending) != 0 {
+		names := map[string]struct{}{}
+		for _, flag := range pending {
+			names[flag.FlagName()] = struct{}{}
+		}
+
+		var next []Flag
+		for _, flag := range pending {
+			if _, waiting := names[flag.DefaultFrom]; waiting {
+				next = append(next, flag)
+				continue
+			}
+
+			value, found := c.Get(flag.DefaultFrom)
+			if !found {
+				value = flag.DefaultValue()
+			}
+			if value == nil {
+				continue
+			}
+			if !flag.Type.accepts(value) {
+				return fmt.Errorf("flag %q: can not default to %T value of flag %q", flag.Name, value, flag.DefaultFrom)
+			}
+
+			raw := fmt.Sprint(value)
+			if found {
+				raw = c.Raw(flag.DefaultFrom)
+			}
+			if err := c.set(flag, value, raw, SourceDefault); err != nil {
+				return err
+			}
+		}
+
+		if len(next) == len(pending) {
+			return fmt.Errorf("flag %q: cyclic default from flag %q", next[0].Name, next[0].DefaultFrom)
+		}
+		pending = next
+	}
+	return nil
+}
+
+// parentSource returns the source the value of giving key was resolved
+// from in the parents of the context.
+func (c *ctxImpl) parentSource(key string) (string, bool) {
+	parent, ok := c.parent.(*ctxImpl)
+	if !ok {
+		return "", false
+	}
+	if source, ok := parent.sources[key]; ok {
+		return source, true
+	}
+	return parent.parentSource(key)
+}
+
+// flagKey returns the key giving flag name is provided under in the
+// parsed arguments, which is lowercased when the run matches flag names
+// regardless of case.
+func (c *ctxImpl) flagKey(name string) string {
+	if c.conf.caseInsensitive {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// expand returns giving values of flag resolved from giving source with
+// command substitutions replaced by the output of their commands and the
+// remaining values interpolated, when enabled for the run. Commands are
+// only run for values provided as arguments, never for those of files
+// or the environment, which could otherwise run any command.
+func (c *ctxImpl) expand(flag Flag, values []string, source string) ([]string, error) {
+	if !c.conf.substitute || source != SourceFlag {
+		return c.interpolate(flag, values)
+	}
+
+	expanded := make([]string, len(values))
+	for index, value := range values {
+		var err error
+		if isSubstitution(value) {
+			expanded[index], err = substitute(flag, value)
+		} else {
+			// the output of commands is never interpolated.
+			var interpolated []string
+			interpolated, err = c.interpolate(flag, []string{value})
+			if err == nil {
+				expanded[index] = interpolated[0]
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+// isSubstitution returns true/false if giving value is a command
+// substitution, as in `$(cat secret.txt)`.
+func isSubstitution(value string) bool {
+	return strings.HasPrefix(value, "$(") && strings.HasSuffix(value, ")")
+}
+
+// substitute runs the command of giving command substitution value of
+// flag without a shell, returning its output without surrounding space.
+func substitute(flag Flag, value string) (string, error) {
+	fields := strings.Fields(value[2 : len(value)-1])
+	if len(fields) == 0 {
+		return "", fmt.Errorf("flag %q: empty command substitution", flag.FlagName())
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(fields[0], fields[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%s: %s", err, msg)
+		}
+		return "", fmt.Errorf("flag %q: command %q failed: %s", flag.FlagName(), fields[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// interpolate replaces references to the values of already resolved
+// flags, such as {{.name}}, within giving values of flag when the run
+// enables interpolation.
+func (c *ctxImpl) interpolate(flag Flag, values []string) ([]string, error) {
+	if !c.conf.interpolate {
+		return values, nil
+	}
+
+	var data map[string]interface{}
+	interpolated := make([]string, len(values))
+	for index, value := range values {
+		if !strings.Contains(value, "{{") {
+			interpolated[index] = value
+			continue
+		}
+		if data == nil {
+			data = c.resolved()
+		}
+
+		tml, err := template.New(flag.FlagName()).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("flag %q: interpolating %q: %s", flag.FlagName(), value, err)
+		}
+		var out strings.Builder
+		if err := tml.Execute(&out, data); err != nil {
+			return nil, fmt.Errorf("flag %q: interpolating %q: %s", flag.FlagName(), value, err)
+		}
+		interpolated[index] = out.String()
+	}
+	return interpolated, nil
+}
+
+// resolved returns the values of the flags resolved so far by the
+// context and its parents, where values of the context take precedence.
+func (c *ctxImpl) resolved() map[string]interface{} {
+	values := map[string]interface{}{}
+	if parent, ok := c.parent.(*ctxImpl); ok {
+		values = parent.resolved()
+	}
+	for key, value := range c.pairs {
+		values[key] = value
+	}
+	return values
+}
+
+// set stores the resolved value of giving flag with the raw string and
+// source it was resolved from, notifying the flag observer of the run
+// if any.
+func (c *ctxImpl) set(flag Flag, value interface{}, raw string, source string) error {
+	c.pairs[flag.FlagName()] = value
+	c.pairs[flag.FlagAlias()] = value
+	c.sources[flag.FlagName()] = source
+	c.sources[flag.FlagAlias()] = source
+	c.raws[flag.FlagName()] = raw
+	c.raws[flag.FlagAlias()] = raw
+
+	if err := flag.assign(value); err != nil {
+		return err
+	}
+
+	if c.conf == nil || c.conf.observer == nil {
+		return nil
+	}
+
+	if flag.Secret {
+		value = secretMask
+	}
+	c.conf.observer(flag.FlagName(), value, source)
+	return nil
+}
+
+// CommandFunc defines a function type that modifies a giving Command.
+type CommandFunc func(*Command)
+
+// ShortDesc sets giving name for provided command.
+func ShortDesc(desc string) CommandFunc {
+	return func(cmd *Command) {
+		cmd.ShortDesc = desc
+	}
+}
+
+// Desc sets giving name for provided command.
+func Desc(desc string) CommandFunc {
+	return func(cmd *Command) {
+		cmd.Desc = desc
+	}
+}
+
+// WithAction sets giving name for provided command.
+func WithAction(ac Action) CommandFunc {
+	return func(cmd *Command) {
+		cmd.Action = ac
+	}
+}
+
+// Before sets a function called with the context of provided command
+// before its sub command or action is executed. The returned context,
+// as derived with Context.WithValue, is passed on in place of the
+// provided one.
+func Before(fn func(Context) (Context, error)) CommandFunc {
+	return func(cmd *Command) {
+		cmd.Before = fn
+	}
+}
+
+// WithEnv sets environment variables for provided command, which take
+// precedence over the process environment for the Env of it's flags and
+// the Context.Getenv calls of it's action.
+func WithEnv(env map[string]string) CommandFunc {
+	return func(cmd *Command) {
+		if cmd.Env == nil {
+			cmd.Env = map[string]string{}
+		}
+		for key, value := range env {
+			cmd.Env[key] = value
+		}
+	}
+}
+
+// DeprecatedCommand marks provided command as deprecated, with giving
+// message printed as a warning whenever the command is invoked.
+func DeprecatedCommand(message string) CommandFunc {
+	return func(cmd *Command) {
+		cmd.Deprecated = message
+	}
+}
+
+// Alias adds giving name as an alias of provided command, which when
+// invoked applies the preset flag values unless explicitly provided.
+func Alias(name string, preset map[string]string) CommandFunc {
+	return func(cmd *Command) {
+		if cmd.Aliases == nil {
+			cmd.Aliases = map[string]map[string]string{}
+		}
+		cmd.Aliases[strings.ToLower(name)] = preset
+	}
+}
+
+// HiddenAlias adds giving names as alternative names of provided command
+// which are never listed in help, allowing a renamed command to keep
+// working for existing scripts.
+func HiddenAlias(names ...string) CommandFunc {
+	return func(cmd *Command) {
+		for _, name := range names {
+			cmd.HiddenAliases = append(cmd.HiddenAliases, strings.ToLower(name))
+		}
+	}
+}
+
+// ExactlyOneOf adds a group of flags of provided command of which
+// exactly one must be provided, either through argument or environment.
+func ExactlyOneOf(names ...string) CommandFunc {
+	return func(cmd *Command) {
+		cmd.ExactlyOne = append(cmd.ExactlyOne, names)
+	}
+}
+
+// MutuallyExclusive adds a group of flags of provided command of which
+// at most one can be provided, either through argument or environment.
+func MutuallyExclusive(names ...string) CommandFunc {
+	return func(cmd *Command) {
+		cmd.Exclusive = append(cmd.Exclusive, names)
+	}
+}
+
+// RequireOneOf adds a group of mutually exclusive flags of provided
+// command of which one must also be provided, as with ExactlyOneOf.
+func RequireOneOf(names ...string) CommandFunc {
+	return ExactlyOneOf(names...)
+}
+
+// WithArgsFile enables the args-file flag for provided command, which
+// reads additional flags of the command from the giving file, one or
+// more per line with lines starting with a `#` ignored.
+func WithArgsFile() CommandFunc {
+	return func(cmd *Command) {
+		cmd.ArgsFile = true
+	}
+}
+
+// WithEagerValidation makes provided command resolve all of its flags
+// before failing, reporting the errors of every invalid flag together.
+func WithEagerValidation() CommandFunc {
+	return func(cmd *Command) {
+		cmd.EagerValidation = true
+	}
+}
+
+// WithRequires declares external binaries, such as git or docker, which
+// provided command needs, failing the command before its action runs
+// when any of them is not found in PATH.
+func WithRequires(binaries ...string) CommandFunc {
+	return func(cmd *Command) {
+		cmd.Requires = append(cmd.Requires, binaries...)
+	}
+}
+
+// UsageTemplate sets the text/template used in place of the default
+// template to generate the usage text of provided command.
+func UsageTemplate(tml string) CommandFunc {
+	return func(cmd *Command) {
+		cmd.Template = tml
+	}
+}
+
+// Usage sets adds usage text for provided command.
+func Usage(desc string) CommandFunc {
+	return func(cmd *Command) {
+		cmd.Usages = append(cmd.Usages, desc)
+	}
+}
+
+// WithExample adds an example invocation of provided command with a
+// description of what it does.
+func WithExample(command string, desc string) CommandFunc {
+	return func(cmd *Command) {
+		cmd.Examples = append(cmd.Examples, Example{Command: command, Description: desc})
+	}
+}
+
+// SubCommands adds giving commands into command list of
+// parent.
+func SubCommands(cms ...Command) CommandFunc {
+	return func(cmd *Command) {
+		for _, cm := range cms {
+			cmd.Commands[cm.Name] = cm
+		}
+	}
+}
+
+// Example defines an example invocation of a command with a description
+// explaining it, shown in the help of the command.
+type Example struct {
+	Command     string
+	Description string
+}
+
+// Command defines structures which define specific actions to be executed
+// with associated flags.
+// Commands provided will have their ShortDesc trimmed to 100 in length, so
+// ensure to have what you wanna say fit 100 and put more detail explanations
+// in Desc field.
+//
+// A Command is never modified once constructed, which makes it safe to
+// run the same command tree from multiple goroutines, as each call to
+// Run creates its own context and flag values.
+//
+// Stdout and Stderr are nil unless set, in which case the command writes
+// to those of its parent context, ending at the writers of WithStdout and
+// WithStderr or os.Stdout and os.Stderr. Code reading the fields directly
+// should use Context.Stdout and Context.Stderr of the command instead.
+type Command struct {
+	Name            string
+	Desc            string
+	ShortDesc       string
+	Action          Action
+	Before          func(Context) (Context, error)
+	Flags           []Flag
+	Usages          []string
+	Examples        []Example
+	FlagUsage       string
+	CommandUsage    string
+	Stderr          io.Writer
+	Stdout          io.Writer
+	Env             map[string]string
+	Deprecated      string
+	Aliases         map[string]map[string]string
+	HiddenAliases   []string
+	ExactlyOne      [][]string
+	Exclusive       [][]string
+	ArgsFile        bool
+	EagerValidation bool
+	Requires        []string
+	Template        string
+	Commands        map[string]Command
+
+	globals      []Flag
+	plain        bool
+	preserveCase bool
+	compiled     bool
+	err          error
+}
+
+// Run executes giving command with argv.Argv object.
+func (c *Command) Run(arg *argv.Argv, parent Context) error {
+	stdout, stderr := c.writers(parent)
+	conf := runConfigOf(parent)
+	silent := conf.silent
+
+	// trailing tokens not naming a sub command are positional arguments,
+	// with any flags following them belonging to this command.
+	if arg.Sub != nil {
+		if _, _, ok := findCommand(c.Commands, arg.Sub.Name); !ok {
+			flat := arg.Flatten()
+			arg = &flat
+		}
+	}
+
+	if arg.HasKV("help") || arg.HasKV("h") {
+		if silent {
+			return ErrHelp
+		}
+		if err := c.printUsage(stderr); err != nil {
+			return err
+		}
+		return ErrHelp
+	}
+
+	if arg.HasKV("flags") {
+		if silent {
+			return ErrHelp
+		}
+		if err := c.printFlagUsage(stderr); err != nil {
+			return err
+		}
+		return ErrHelp
+	}
+
+	var fileFlags map[string]struct{}
+	if c.ArgsFile && arg.HasKV("args-file") {
+		withFile, fromFile, err := c.readArgsFile(arg, conf)
+		if err != nil {
+			return err
+		}
+		arg, fileFlags = withFile, fromFile
+	}
+
+	if c.Deprecated != "" {
+		fmt.Fprintf(stderr, "command %q is deprecated: %s\n", c.Name, c.Deprecated)
+	}
+
+	var childCtx ctxImpl
+	childCtx.parent = parent
+	childCtx.ctx = parent.Ctx()
+	childCtx.inherit(parent, c.Name)
+	childCtx.command = c
+	childCtx.raw = arg
+	childCtx.HelpPrinter = func() {
+		if err := c.printUsage(stderr); err != nil {
+			fmt.Fprintln(stderr, err)
+		}
+	}
+	childCtx.stdout = stdout
+	childCtx.stderr = stderr
+	childCtx.env = c.Env
+	childCtx.fileFlags = fileFlags
+	// built-in flags provided to a command apply to it and its sub commands.
+	flags := c.Flags
+	for _, flag := range childCtx.conf.builtins {
+		if arg.HasKV(flag.FlagName()) || flag.FlagAlias() != "" && arg.HasKV(flag.FlagAlias()) {
+			flags = append(flags[:len(flags):len(flags)], flag)
+		}
+	}
+	// global flags provided after the command, as in `add --config a.yaml`,
+	// likewise apply to it, unless shadowed by a flag closer to it.
+	for _, flag := range inheritedFlags(c.Flags, c.globals) {
+		if arg.HasKV(childCtx.flagKey(flag.FlagName())) || flag.FlagAlias() != "" && arg.HasKV(childCtx.flagKey(flag.FlagAlias())) {
+			flags = append(flags[:len(flags):len(flags)], flag)
+		}
+	}
+
+	if c.ArgsFile {
+		flags = append(flags[:len(flags):len(flags)], argsFileFlag)
+	}
+
+	childCtx.eager = c.EagerValidation
+	err := childCtx.process(arg, flags)
+	if err != nil && !c.EagerValidation {
+		return c.usageError(err)
+	}
+	if groupErr := childCtx.checkExactlyOne(c.ExactlyOne); groupErr != nil {
+		err = errors.Join(err, fmt.Errorf("command %q: %s", c.Name, groupErr))
+	}
+	if groupErr := childCtx.checkExclusive(c.Exclusive); groupErr != nil {
+		err = errors.Join(err, fmt.Errorf("command %q: %s", c.Name, groupErr))
+	}
+	if err != nil {
+		return c.usageError(err)
+	}
+
+	if c.Before != nil {
+		derived, err := c.Before(&childCtx)
+		if err != nil {
+			return err
+		}
+		impl, ok := derived.(*ctxImpl)
+		if !ok {
+			return fmt.Errorf("command %q: before must return a context derived from the provided one", c.Name)
+		}
+		childCtx = *impl
+	}
+
+	// if we are dealing with possible tree then go down the tree,
+	// declared sub commands take precedence over positional arguments.
+	if arg.Sub != nil {
+		if _, _, ok := findCommand(c.Commands, arg.Sub.Name); ok {
+			return c.runSubCommand(arg.Sub, &childCtx)
+		}
+	}
+
+	// if we are dealing with the final argv, then is the it's text
+	// value a command also, if it is, make a new chain and pass it on.
+	if _, _, ok := findCommand(c.Commands, arg.Text); ok && arg.Sub == nil {
+		arg.Sub = argv.New(arg.Text)
+		return c.runSubCommand(arg.Sub, &childCtx)
+	}
+
+	// any trailing tokens not matching a sub command are positional
+	// arguments of the command.
+	if len(arg.Args) != 0 && childCtx.conf.noPositionals {
+		return c.usageError(fmt.Errorf("unexpected argument %q", arg.Args[0]))
+	}
+	childCtx.args = arg.Args
+
+	// a command only grouping sub commands lists them when invoked bare,
+	// returning ErrHelp as for --help.
+	if c.Action == nil && len(c.Commands) != 0 && arg.Sub == nil && arg.Text == "" {
+		if silent {
+			return ErrHelp
+		}
+		if err := c.printUsage(stderr); err != nil {
+			return err
+		}
+		return ErrHelp
+	}
+
+	if c.Action == nil {
+		return fmt.Errorf("no action associated with command %q", c.Name)
+	}
+
+	for _, binary := range c.Requires {
+		if _, err := exec.LookPath(binary); err != nil {
+			return fmt.Errorf("command %q: required binary %q not found in PATH", c.Name, binary)
+		}
+	}
+
+	cancel := func() {}
+	ctx := parent.Ctx()
+	_, hasTimeout := childCtx.Get("timeout")
+	if hasTimeout {
+		childCtx.ctx, cancel = context.WithTimeout(ctx, childCtx.Duration("timeout"))
+	}
+
+	defer cancel()
+
+	start := time.Now()
+	err = c.Action(&childCtx)
+	elapsed := time.Since(start)
+
+	if err != nil && hasTimeout && childCtx.ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("command %q timed out after %s: %w", c.Name, childCtx.Duration("timeout"), err)
+	}
+	childCtx.conf.metrics.RecordCommand(childCtx.path, elapsed, err)
+
+	if err != nil && childCtx.conf.errorPath {
+		err = fmt.Errorf("%s: %w", strings.Join(childCtx.path, " > "), err)
+	}
+
+	if childCtx.builtinBool("timings") {
+		fmt.Fprintf(stderr, "command %q took %s\n", c.Name, elapsed.Round(time.Millisecond))
+	}
+	return err
+}
+
+// writers returns the standard output and error of the command,
+// falling back to those of the parent context if none was set.
+func (c *Command) writers(parent Context) (io.Writer, io.Writer) {
+	stdout, stderr := c.Stdout, c.Stderr
+	if stdout == nil {
+		stdout = parent.Stdout()
+	}
+	if stderr == nil {
+		stderr = parent.Stderr()
+	}
+	return stdout, stderr
+}
+
+func (c *Command) runSubCommand(arg *argv.Argv, parent Context) error {
+	if sub, preset, ok := findCommand(c.Commands, arg.Name); ok {
+		applyPreset(arg, preset)
+		return sub.Run(arg, parent)
+	}
+	return c.usageError(fmt.Errorf("%q has no subcommand named %q", c.Name, arg.Name))
+}
+
+// usageError returns giving error as a UsageError carrying the usage
+// text of the command.
+func (c *Command) usageError(err error) error {
+	var usage strings.Builder
+	if renderErr := c.printUsage(&usage); renderErr != nil {
+		usage.Reset()
+	}
+	return &UsageError{Err: err, Usage: usage.String()}
+}
+
+// readArgsFile returns a copy of giving argv with the flags read from
+// the file provided through the args-file flag, where flags provided
+// on the command line take precedence, along with the names of the
+// flags whose values came from the file. Flags of the file take their
+// value as on the command line, while positional arguments are rejected.
+func (c *Command) readArgsFile(arg *argv.Argv, conf *runConfig) (*argv.Argv, map[string]struct{}, error) {
+	paths := arg.Pairs["args-file"]
+	data, err := os.ReadFile(paths[len(paths)-1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("command %q: failed to read args file: %s", c.Name, err)
+	}
+
+	// lines are kept whole, such that quoted values may hold spaces.
+	lines := []string{argv.Join([]string{c.Name})}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+
+	declared := append(c.Flags[:len(c.Flags):len(c.Flags)], conf.builtins...)
+	parsed, err := argv.ParseWithValues(strings.Join(lines, " "), valueFlags(append(declared, argsFileFlag), nil, conf))
+	if err != nil {
+		return nil, nil, fmt.Errorf("command %q: invalid args file: %s", c.Name, err)
+	}
+	fileArg := parsed.Flatten()
+	if len(fileArg.Args) != 0 || len(fileArg.Remainder) != 0 {
+		return nil, nil, fmt.Errorf("command %q: args file may only hold flags, got %q", c.Name, append(fileArg.Args, fileArg.Remainder...))
+	}
+	if conf.caseInsensitive {
+		lowerFlags(&fileArg)
+	}
+
+	merged := *arg
+	merged.Pairs = make(map[string][]string, len(arg.Pairs)+len(fileArg.Pairs))
+	fromFile := make(map[string]struct{}, len(fileArg.Pairs))
+	for key, values := range fileArg.Pairs {
+		merged.Pairs[key] = values
+		fromFile[key] = struct{}{}
+	}
+	for key, values := range arg.Pairs {
+		merged.Pairs[key] = values
+		delete(fromFile, key)
+	}
+	return &merged, fromFile, nil
+}
+
+// findCommand returns the command matching giving name either by it's
+// name or one of it's aliases, with the preset flag values of the alias.
+func findCommand(cmds map[string]Command, name string) (Command, map[string]string, bool) {
+	if cmd, ok := cmds[name]; ok {
+		return cmd, nil, true
+	}
+	for _, cmd := range cmds {
+		if preset, ok := cmd.Aliases[name]; ok {
+			return cmd, preset, true
+		}
+		for _, alias := range cmd.HiddenAliases {
+			if alias == name {
+				return cmd, nil, true
+			}
+		}
+	}
+	return Command{}, nil, false
+}
+
+// applyPreset adds the preset flag values into giving argv for
+// all flags not explicitly provided.
+func applyPreset(arg *argv.Argv, preset map[string]string) {
+	if len(preset) == 0 {
+		return
+	}
+	if arg.Pairs == nil {
+		arg.Pairs = map[string][]string{}
+	}
+	for key, value := range preset {
+		if _, ok := arg.Pairs[key]; !ok {
+			arg.Pairs[key] = []string{value}
+		}
+	}
+}
+
+// Walk calls giving function for each of the commands and their sub
+// commands with the names of the commands leading to it, visiting a
+// command before its sub commands, which are visited ordered by name.
+// Walk stops at the first error returned by the function, or when a
+// command is found to contain itself.
+func Walk(cmds []Command, fn func(path []string, cmd Command) error) error {
+	return walk(nil, nil, cmds, fn)
+}
+
+// walk visits giving commands below the parent path, where ancestors
+// holds the sub command maps of the commands along the path, as a
+// command holding itself as a sub command shares it's map.
+func walk(parent []string, ancestors []uintptr, cmds []Command, fn func([]string, Command) error) error {
+	for _, cmd := range cmds {
+		path := append(append([]string(nil), parent...), cmd.Name)
+		if err := fn(path, cmd); err != nil {
+			return err
+		}
+
+		if len(cmd.Commands) == 0 {
+			continue
+		}
+
+		id := reflect.ValueOf(cmd.Commands).Pointer()
+		for i, ancestor := range ancestors {
+			if ancestor == id {
+				return fmt.Errorf("command cycle detected: %s > %s", strings.Join(path[i:len(path)-1], " > "), cmd.Name)
+			}
+		}
+
+		names := make([]string, 0, len(cmd.Commands))
+		for name := range cmd.Commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		subs := make([]Command, 0, len(names))
+		for _, name := range names {
+			subs = append(subs, cmd.Commands[name])
+		}
+		if err := walk(path, append(ancestors[:len(ancestors):len(ancestors)], id), subs, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListCommands returns the dotted paths of giving commands and all their
+// sub commands, such as "config.init", in the order visited by Walk,
+// returning an error if a command is found to contain itself.
+func ListCommands(cmds []Command) ([]string, error) {
+	var paths []string
+	err := Walk(cmds, func(path []string, cmd Command) error {
+		paths = append(paths, strings.Join(path, "."))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// GraphViz writes the hierarchy of giving commands below the program
+// title to w in the DOT language of Graphviz, with a node for each
+// command named by its dotted path and an edge from each command to
+// its sub commands.
+func GraphViz(title string, cmds []Command, w io.Writer) error {
+	var graph strings.Builder
+	fmt.Fprintf(&graph, "digraph %q {\n", title)
+	fmt.Fprintf(&graph, "\t%q [label=%q];\n", title, title)
+	err := Walk(cmds, func(path []string, cmd Command) error {
+		node := strings.Join(path, ".")
+		parent := title
+		if len(path) > 1 {
+			parent = strings.Join(path[:len(path)-1], ".")
+		}
+		fmt.Fprintf(&graph, "\t%q [label=%q];\n", node, cmd.Name)
+		fmt.Fprintf(&graph, "\t%q -> %q;\n", parent, node)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	graph.WriteString("}\n")
+
+	_, err = io.WriteString(w, graph.String())
+	return err
+}
+
+// Commands returns the passed in set of variadic arguments
+// returning them as a slice.
+func Commands(cmds ...Command) []Command {
+	return cmds
+}
+
+// Cmd returns a new Command from the provided options.
+// If the usage text of the command fails to compile, the error is
+// returned when the command is run, see CmdE for a variant returning
+// the error at once.
+func Cmd(name string, ops ...CommandFunc) Command {
+	cm, err := CmdE(name, ops...)
+	cm.err = err
+	return cm
+}
+
+// CmdE returns a new Command from the provided options, returning an
+// error if the usage text of the command fails to compile.
+//
+// The usage text of commands using the default templates is rendered
+// when help is requested, such that large command trees don't pay for
+// help they rarely show, while usage text of a custom template is
+// compiled upfront to report errors of the template.
+func CmdE(name string, ops ...CommandFunc) (Command, error) {
+	cm := Command{
+		Commands: map[string]Command{},
+		Name:     strings.ToLower(name),
+	}
+
+	for _, op := range ops {
+		op(&cm)
+	}
+
+	if cm.Template == "" {
+		return cm, nil
+	}
+	err := cm.compileUsage(cm.usageTemplate(), flagUsageTml)
+	cm.compiled = err == nil
+	return cm, err
+}
+
+// printUsage writes the usage text of the command to giving writer,
+// rendering it unless set on the command.
+func (c *Command) printUsage(w io.Writer) error {
+	usage := c.CommandUsage
+	if usage == "" {
+		rendered := *c
+		if err := rendered.compileUsage(c.templates()); err != nil {
+			return err
+		}
+		usage = rendered.CommandUsage
+	}
+	_, err := io.WriteString(w, usage)
+	return err
+}
+
+// printFlagUsage writes the flag usage text of the command to giving
+// writer, rendering it unless set on the command.
+func (c *Command) printFlagUsage(w io.Writer) error {
+	usage := c.FlagUsage
+	if usage == "" {
+		rendered := *c
+		if err := rendered.compileUsage(c.templates()); err != nil {
+			return err
+		}
+		usage = rendered.FlagUsage
+	}
+	_, err := io.WriteString(w, usage)
+	return err
+}
+
+// templates returns the templates of the command and flag usage text
+// of the command, without braille glyphs in plain mode.
+func (c *Command) templates() (string, string) {
+	if c.plain {
+		return plainTemplate(c.usageTemplate()), plainTemplate(flagUsageTml)
+	}
+	return c.usageTemplate(), flagUsageTml
+}
+
+// usageTemplate returns the template for the usage text of the command.
+func (c *Command) usageTemplate() string {
+	if c.Template != "" {
+		return c.Template
+	}
+	return cmdUsageTml
+}
+
+// compileUsage generates the command and flag usage text of the
+// command using the provided templates.
+func (c *Command) compileUsage(cmdTml string, flagTml string) error {
+	data := struct {
+		Title       string
+		Cmd         Command
+		Commands    map[string]Command
+		GlobalFlags []Flag
+	}{
+		Cmd:         *c,
+		Title:       c.Name,
+		Commands:    c.Commands,
+		GlobalFlags: c.globals,
+	}
+
+	funcs := defs
+	if c.preserveCase {
+		funcs = preserveCaseDefs()
+	}
+
+	tml, err := template.New("command.Usage").Funcs(funcs).Parse(cmdTml)
+	if err != nil {
+		return fmt.Errorf("failed to create usage template for command %q: %w", c.Name, err)
+	}
+
+	var bu bytes.Buffer
+	if err := tml.Execute(&bu, data); err != nil {
+		return fmt.Errorf("error occured compiling command %q usage text: %w", c.Name, err)
+	}
+	c.CommandUsage = bu.String()
+
+	tml, err = template.New("flags.Usage").Funcs(funcs).Parse(flagTml)
+	if err != nil {
+		return fmt.Errorf("failed to create flag usage template for command %q: %w", c.Name, err)
+	}
+
+	bu.Reset()
+	if err := tml.Execute(&bu, data); err != nil {
+		return fmt.Errorf("error occured compiling command %q flag usage text: %w", c.Name, err)
+	}
+	c.FlagUsage = bu.String()
+
+	return nil
+}
+
+// RenderHelp writes the usage text of giving command to the writer,
+// generated from the current fields of the command rather than the
+// usage text compiled when it was created.
+func RenderHelp(c Command, w io.Writer) error {
+	if err := c.compileUsage(c.usageTemplate(), flagUsageTml); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, c.CommandUsage)
+	return err
+}
+
+// globalCommand returns a copy of giving command and it's sub commands
+// with usage text listing giving global flags, along with the flags
+// inherited from parent commands, apart from their own. Commands
+// without any global flags keep their usage text.
+func globalCommand(c Command, globals []Flag) Command {
+	c.globals = globals
+
+	inherited := append(append([]Flag(nil), globals...), c.Flags...)
+	subs := make(map[string]Command, len(c.Commands))
+	for name, sub := range c.Commands {
+		subs[name] = globalCommand(sub, inherited)
+	}
+
+	c.Commands = subs
+	if len(globals) != 0 {
+		c.clearUsage()
+	}
+	return c
+}
+
+// inheritedFlags returns giving global flags of a command which are not
+// shadowed by a flag of the same name or alias among giving flags of the
+// command, or among later global flags, which are closer to the command.
+func inheritedFlags(flags []Flag, globals []Flag) []Flag {
+	taken := map[string]bool{}
+	for _, flag := range flags {
+		taken[flag.FlagName()], taken[flag.FlagAlias()] = true, true
+	}
+
+	var inherited []Flag
+	for index := len(globals) - 1; index >= 0; index-- {
+		flag := globals[index]
+		if taken[flag.FlagName()] || flag.FlagAlias() != "" && taken[flag.FlagAlias()] {
+			continue
+		}
+		taken[flag.FlagName()], taken[flag.FlagAlias()] = true, true
+		inherited = append(inherited, flag)
+	}
+	return inherited
+}
+
+// plainCommand returns a copy of giving command and it's sub commands
+// with usage text generated from the plain templates.
+func plainCommand(c Command) Command {
+	subs := make(map[string]Command, len(c.Commands))
+	for name, sub := range c.Commands {
+		subs[name] = plainCommand(sub)
+	}
+
+	c.Commands = subs
+	c.plain = true
+	c.clearUsage()
+	return c
+}
+
+// preserveCaseCommand returns a copy of giving command and it's sub
+// commands with usage text showing flag names with their original case.
+func preserveCaseCommand(c Command) Command {
+	subs := make(map[string]Command, len(c.Commands))
+	for name, sub := range c.Commands {
+		subs[name] = preserveCaseCommand(sub)
+	}
+
+	c.Commands = subs
+	c.preserveCase = true
+	c.clearUsage()
+	return c
+}
+
+// clearUsage removes the usage text compiled when the command was
+// created, to be rendered again from the current fields on demand,
+// keeping usage text set on the command by the user.
+func (c *Command) clearUsage() {
+	if c.compiled {
+		c.CommandUsage, c.FlagUsage, c.compiled = "", "", false
+	}
+}
+
+// plainTemplate returns a variant of giving template where the braille
+// glyphs are replaced with ascii characters.
+func plainTemplate(tml string) string {
+	return plainReplacer.Replace(tml)
+}
+
+// RunOption defines a function type which configures the behaviour
+// of Run.
+type RunOption func(*runConfig)
+
+type runConfig struct {
+	args            []string
+	plain           bool
+	exit            func(int)
+	noExit          bool
+	errorPath       bool
+	reload          func(Context) error
+	builtins        []Flag
+	config          map[string]interface{}
+	configFiles     []string
+	optionalConfig  bool
+	configCommand   bool
+	dotEnv          map[string]string
+	dotEnvFiles     []string
+	dotEnvOverride  bool
+	signals         <-chan os.Signal
+	noPositionals   bool
+	preserveCase    bool
+	silent          bool
+	version         string
+	template        string
+	stdout          io.Writer
+	stderr          io.Writer
+	metrics         MetricsSink
+	observer        FlagObserver
+	keyring         Keyring
+	interpolate     bool
+	formats         bool
+	substitute      bool
+	caseInsensitive bool
+}
+
+// MetricsSink defines a interface which receives the path, duration
+// and resulting error of every executed command action.
+type MetricsSink interface {
+	RecordCommand(path []string, dur time.Duration, err error)
+}
+
+type noopMetrics struct{}
+
+// RecordCommand implements the MetricsSink interface.
+func (noopMetrics) RecordCommand([]string, time.Duration, error) {}
+
+// FlagObserver defines a function type which is called with the name,
+// value and source of every resolved flag.
+type FlagObserver func(name string, value interface{}, source string)
+
+// WithFlagObserver returns a RunOption which sets the FlagObserver to be
+// called for every resolved flag before a command action runs, enabling
+// audit trails of the configuration a command ran with. The values of
+// secret flags are masked.
+func WithFlagObserver(observer FlagObserver) RunOption {
+	return func(rc *runConfig) {
+		rc.observer = observer
+	}
+}
+
+// WithMetrics returns a RunOption which sets the MetricsSink to be
+// notified after every executed command action.
+func WithMetrics(sink MetricsSink) RunOption {
+	return func(rc *runConfig) {
+		rc.metrics = sink
+	}
+}
+
+// WithPlainHelp returns a RunOption which renders all help messages
+// without the braille glyphs of the default templates, for terminals
+// and fonts unable to display them.
+func WithPlainHelp() RunOption {
+	return func(rc *runConfig) {
+		rc.plain = true
+	}
+}
+
+// WithArgs returns a RunOption which sets the arguments to be parsed
+// in place of os.Args, excluding the name of the program.
+func WithArgs(args []string) RunOption {
+	return func(rc *runConfig) {
+		rc.args = args
+	}
+}
+
+// WithExit returns a RunOption which sets the function called with
+// the status code when Run fails, in place of os.Exit.
+func WithExit(exit func(int)) RunOption {
+	return func(rc *runConfig) {
+		rc.exit = exit
+	}
+}
+
+// WithNoExit returns a RunOption which makes Run return all errors
+// rather than exiting the process, with ErrHelp returned when help
+// was printed, for programs embedding Run.
+func WithNoExit() RunOption {
+	return func(rc *runConfig) {
+		rc.noExit = true
+	}
+}
+
+// WithErrorPath returns a RunOption which prefixes errors returned by
+// command actions with the path of the failing command, as in
+// "deploy > staging > rollback: failed".
+func WithErrorPath() RunOption {
+	return func(rc *runConfig) {
+		rc.errorPath = true
+	}
+}
+
+// WithReloadHandler returns a RunOption which calls giving function
+// with the root context whenever the process receives SIGHUP, instead
+// of the signal terminating the process, allowing long running commands
+// to reload their configuration. Errors of the handler are printed to
+// stderr without ending the command.
+func WithReloadHandler(onReload func(Context) error) RunOption {
+	return func(rc *runConfig) {
+		rc.reload = onReload
+	}
+}
+
+// WithConfigFiles returns a RunOption which reads flag values from
+// giving yaml configuration files, as written by the config init
+// command of WithConfigCommand. Files are applied in order with later files overriding
+// earlier ones, while flags and environment variables override all.
+func WithConfigFiles(paths ...string) RunOption {
+	return func(rc *runConfig) {
+		rc.configFiles = append(rc.configFiles, paths...)
+	}
+}
+
+// WithConfigCommand returns a RunOption which adds the built-in config
+// command, whose init sub command prints a configuration template of
+// all flags, unless the program provides a config command of its own.
+func WithConfigCommand() RunOption {
+	return func(rc *runConfig) {
+		rc.configCommand = true
+	}
+}
+
+// WithOptionalConfig returns a RunOption which skips configuration
+// files that do not exist instead of failing.
+func WithOptionalConfig() RunOption {
+	return func(rc *runConfig) {
+		rc.optionalConfig = true
+	}
 }
 
-// String returns the value type value of a key if it exists.
-func (c *ctxImpl) String(key string) string {
-	if val, found := c.Get(key); found {
-		return val.(string)
+// WithNoPositionals returns a RunOption which rejects any argument
+// of a command that does not name one of its sub commands, for
+// programs made only of sub commands.
+func WithNoPositionals() RunOption {
+	return func(rc *runConfig) {
+		rc.noPositionals = true
 	}
-	return ""
 }
 
-// Get returns the value of a key if it exists.
-// If the key is not seen within present context, then the parent
-// of context is checked for giving key.
-func (c *ctxImpl) Get(key string) (value interface{}, found bool) {
-	if item, ok := c.pairs[key]; ok {
-		return item, true
+// WithInterpolation returns a RunOption which replaces references to
+// flags resolved earlier within the values of later flags, such that
+// --out={{.name}}.log receives the value of --name, flags of a parent
+// command being resolved before those of its sub commands.
+func WithInterpolation() RunOption {
+	return func(rc *runConfig) {
+		rc.interpolate = true
 	}
-	if c.parent == nil {
-		return nil, false
+}
+
+// WithCaseInsensitiveFlags returns a RunOption which matches provided
+// flags to declared flags regardless of case, such that --NAME and
+// --Name both provide the name flag.
+func WithCaseInsensitiveFlags() RunOption {
+	return func(rc *runConfig) {
+		rc.caseInsensitive = true
 	}
-	return c.parent.Get(key)
 }
 
-// IsSet returns true/false if giving key was set in command context.
-func (c *ctxImpl) IsSet(key string) bool {
-	if _, ok := c.pairs[key]; ok {
-		return true
+// WithCommandSubstitution returns a RunOption which replaces flag values
+// written as `$(command args...)` with the output of running the command,
+// without surrounding space, failing if the command fails. The command
+// is run directly rather than through a shell, so arguments are split
+// on spaces without quoting, and pipes, redirects and variables are not
+// supported. Only values provided as arguments on the command line are
+// substituted, values of args files, environment variables, .env files
+// and config files are kept as is, as such files could otherwise run
+// any command on the machine.
+func WithCommandSubstitution() RunOption {
+	return func(rc *runConfig) {
+		rc.substitute = true
 	}
-	return false
 }
 
-func (c *ctxImpl) process(arg *argv.Argv, flags []Flag) error {
-	if c.pairs == nil {
-		c.flags = map[string]struct{}{}
-		c.pairs = map[string]interface{}{}
+// WithPreserveCase returns a RunOption which shows the title of the
+// program and the names of flags in the help of the program and its
+// commands with their original case instead of lowercased. Command
+// names are lowercased when created, so they show lowercased.
+func WithPreserveCase() RunOption {
+	return func(rc *runConfig) {
+		rc.preserveCase = true
 	}
+}
 
-	for _, flag := range flags {
-		c.flags[flag.FlagName()] = struct{}{}
-		c.flags[flag.FlagAlias()] = struct{}{}
-		if flagValue, provided := arg.Pairs[flag.FlagName()]; provided {
-			value, err := flag.Parse(flagValue[0], flagValue[1:]...)
-			if err != nil {
-				return err
-			}
-			c.pairs[flag.FlagName()] = value
-			c.pairs[flag.FlagAlias()] = value
-			continue
-		}
-		if flag.Env != "" {
-			value, err := flag.Parse(os.Getenv(flag.Env))
-			if err != nil {
-				return err
-			}
-			c.pairs[flag.FlagName()] = value
-			c.pairs[flag.FlagAlias()] = value
-			continue
-		}
-		if flag.DefaultValue() != nil {
-			c.pairs[flag.FlagName()] = flag.DefaultValue()
-			c.pairs[flag.FlagAlias()] = flag.DefaultValue()
-		}
+// WithUsageTemplate returns a RunOption which sets the text/template
+// used in place of the default template to generate the help message
+// of the program.
+func WithUsageTemplate(tml string) RunOption {
+	return func(rc *runConfig) {
+		rc.template = tml
 	}
-	return nil
 }
 
-// CommandFunc defines a function type that modifies a giving Command.
-type CommandFunc func(*Command)
+// WithVersion returns a RunOption which sets the version of the program,
+// printed with the built-in --version flag.
+func WithVersion(version string) RunOption {
+	return func(rc *runConfig) {
+		rc.version = version
+	}
+}
 
-// ShortDesc sets giving name for provided command.
-func ShortDesc(desc string) CommandFunc {
-	return func(cmd *Command) {
-		cmd.ShortDesc = desc
+// WithStdout returns a RunOption which sets the writer used for
+// standard output in place of os.Stdout, by every command which does
+// not set its own Stdout.
+func WithStdout(w io.Writer) RunOption {
+	return func(rc *runConfig) {
+		rc.stdout = w
 	}
 }
 
-// Desc sets giving name for provided command.
-func Desc(desc string) CommandFunc {
-	return func(cmd *Command) {
-		cmd.Desc = desc
+// WithStderr returns a RunOption which sets the writer used for
+// help and error messages in place of os.Stderr, by every command
+// which does not set its own Stderr.
+func WithStderr(w io.Writer) RunOption {
+	return func(rc *runConfig) {
+		rc.stderr = w
 	}
 }
 
-// WithAction sets giving name for provided command.
-func WithAction(ac Action) CommandFunc {
-	return func(cmd *Command) {
-		cmd.Action = ac
+// Run adds all commands and appropriate flags for each commands.
+// There is no need to call flag.Parse, has this calls it underneath and
+// parses appropriate commands.
+// Errors are printed to stderr with the process exited with a
+// non-zero status code, unless WithNoExit is used, in which case
+// the error is returned, with ErrHelp returned if help was printed.
+// A UsageError is printed after the usage text of the command and
+// exits with status code 2, other errors exit with status code 1.
+// An interrupt or termination signal cancels the context of the running
+// command, waiting for it to return unless a second signal arrives.
+// It is safe to call Run concurrently with the same flags and commands.
+//
+// Run is RunWithError followed by printing and exiting on errors. The
+// other entry points only differ from RunWithError by their options:
+// RunArgs runs with giving arguments in place of os.Args, RunErr does
+// not print the help message or version, and Batch runs as RunErr once
+// for each of giving invocations.
+func Run(title string, flags []Flag, cmds []Command, ops ...RunOption) error {
+	conf := newRunConfig(ops)
+	err := run(title, flags, cmds, &conf)
+	if err == nil || errors.Is(err, ErrHelp) || errors.Is(err, ErrVersion) {
+		if conf.noExit {
+			return err
+		}
+		return nil
+	}
+
+	code := 1
+	var usageErr *UsageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprint(conf.stderr, usageErr.Usage)
+		code = 2
+	}
+
+	fmt.Fprint(conf.stderr, err.Error())
+	if !conf.noExit {
+		conf.exit(code)
 	}
+	return err
 }
 
-// Usage sets adds usage text for provided command.
-func Usage(desc string) CommandFunc {
-	return func(cmd *Command) {
-		cmd.Usages = append(cmd.Usages, desc)
+// RunWithError behaves like Run, printing the help message and version
+// when requested, but returns all errors without printing them or
+// exiting, leaving their handling to the caller. Errors wrap their
+// cause, such as a UsageError for invalid invocations or the template
+// error of a command whose usage text failed to compile, for use with
+// errors.Is and errors.As. ErrHelp and ErrVersion are returned once the
+// help message or version was printed.
+func RunWithError(title string, flags []Flag, cmds []Command, ops ...RunOption) error {
+	conf := newRunConfig(ops)
+	return run(title, flags, cmds, &conf)
+}
+
+// RunArgs behaves like RunWithError, running the commands with giving
+// arguments in place of those of the process, where args excludes the
+// program name and each argument is kept whole. This enables driving
+// the commands from tests or a REPL.
+func RunArgs(title string, args []string, flags []Flag, cmds []Command, ops ...RunOption) error {
+	return RunWithError(title, flags, cmds, append([]RunOption{WithArgs(args)}, ops...)...)
+}
+
+// RunErr behaves like RunWithError, but returns ErrHelp and ErrVersion
+// in place of printing the help message and version.
+func RunErr(title string, flags []Flag, cmds []Command, ops ...RunOption) error {
+	return RunWithError(title, flags, cmds, append(ops[:len(ops):len(ops)], withSilentHelp())...)
+}
+
+// withSilentHelp returns a RunOption which skips printing the help
+// message and version, returning ErrHelp and ErrVersion alone.
+func withSilentHelp() RunOption {
+	return func(rc *runConfig) {
+		rc.silent = true
 	}
 }
 
-// SubCommands adds giving commands into command list of
-// parent.
-func SubCommands(cms ...Command) CommandFunc {
-	return func(cmd *Command) {
-		for _, cm := range cms {
-			cmd.Commands[cm.Name] = cm
+// valueFlags returns the argv.ValueFunc reporting if a flag provided to
+// the command at a path of command names below the program takes the
+// following argument as value, where giving flags are those of the
+// program. Undeclared flags never take the following argument.
+func valueFlags(flags []Flag, commands map[string]Command, conf *runConfig) argv.ValueFunc {
+	return func(path []string, name string) bool {
+		declared, cmds := flags, commands
+		// the first name of the path is the program itself.
+		for index, cmdName := range path {
+			if index == 0 {
+				continue
+			}
+			cmd, _, ok := findCommand(cmds, cmdName)
+			if !ok {
+				break
+			}
+			declared = append(cmd.Flags[:len(cmd.Flags):len(cmd.Flags)], conf.builtins...)
+			declared = append(declared, inheritedFlags(cmd.Flags, cmd.globals)...)
+			if cmd.ArgsFile {
+				declared = append(declared, argsFileFlag)
+			}
+			cmds = cmd.Commands
 		}
+
+		for _, flag := range declared {
+			for _, key := range []string{flag.FlagName(), flag.FlagAlias()} {
+				if key != "" && (key == name || conf.caseInsensitive && strings.EqualFold(key, name)) {
+					return flag.takesValue()
+				}
+			}
+		}
+		return false
 	}
 }
 
-// Command defines structures which define specific actions to be executed
-// with associated flags.
-// Commands provided will have their ShortDesc trimmed to 100 in length, so
-// ensure to have what you wanna say fit 100 and put more detail explanations
-// in Desc field.
-type Command struct {
-	Name         string
-	Desc         string
-	ShortDesc    string
-	Action       Action
-	Flags        []Flag
-	Usages       []string
-	FlagUsage    string
-	CommandUsage string
-	Stderr       io.Writer
-	Stdout       io.Writer
-	Commands     map[string]Command
+// lowerFlags lowercases the names of the flags provided to giving
+// argument and all its sub commands, combining the values of names
+// differing only by case.
+func lowerFlags(arg *argv.Argv) {
+	for ; arg != nil; arg = arg.Sub {
+		pairs := make(map[string][]string, len(arg.Pairs))
+		for key, values := range arg.Pairs {
+			key = strings.ToLower(key)
+			pairs[key] = append(pairs[key], values...)
+		}
+		arg.Pairs = pairs
+	}
 }
 
-// Run executes giving command with argv.Argv object.
-func (c *Command) Run(arg *argv.Argv, parent Context) error {
-	if arg.HasKV("help") || arg.HasKV("h") {
-		_, err := fmt.Fprint(c.Stderr, c.CommandUsage)
-		return err
+// resolveHelp rewrites the help command spellings of giving arguments,
+// as in `help add` and `add help`, into the help flag of the command they
+// name, such that they print the same help as `add --help`. Commands
+// declaring a sub command named help keep it.
+func resolveHelp(arg *argv.Argv, cmds map[string]Command) {
+	if _, _, ok := findCommand(cmds, "help"); ok {
+		return
 	}
 
-	if arg.HasKV("flags") {
-		_, err := fmt.Fprint(c.Stderr, c.FlagUsage)
-		return err
+	// `help add` prints the help of the command following it.
+	if arg.Sub != nil && arg.Sub.Name == "help" {
+		help := arg.Sub
+		arg.Sub, arg.Text, arg.Args = help.Sub, help.Text, help.Args
+		for {
+			if _, _, ok := findCommand(cmds, arg.Text); ok && arg.Sub == nil {
+				arg.Sub, arg.Text, arg.Args = argv.New(arg.Text), "", nil
+			}
+			if arg.Sub == nil {
+				break
+			}
+			cmd, _, ok := findCommand(cmds, arg.Sub.Name)
+			if !ok {
+				break
+			}
+			arg, cmds = arg.Sub, cmd.Commands
+		}
+		// an unknown command name is reported as such.
+		if arg.Text == "" {
+			setHelpFlag(arg)
+		}
+		return
 	}
 
-	if c.Action == nil {
-		return fmt.Errorf("no action associated with command %q", c.Name)
+	// `add help` prints the help of the command preceding it.
+	for arg.Sub != nil {
+		cmd, _, ok := findCommand(cmds, arg.Sub.Name)
+		if !ok {
+			return
+		}
+		arg, cmds = arg.Sub, cmd.Commands
 	}
+	if _, _, ok := findCommand(cmds, "help"); !ok && arg.Text == "help" && len(arg.Args) == 1 {
+		arg.Text, arg.Args = "", nil
+		setHelpFlag(arg)
+	}
+}
 
-	var childCtx ctxImpl
-	childCtx.parent = parent
-	childCtx.ctx = parent.Ctx()
-	if err := childCtx.process(arg, c.Flags); err != nil {
-		return err
+// setHelpFlag sets the help flag on giving arguments.
+func setHelpFlag(arg *argv.Argv) {
+	if arg.Pairs == nil {
+		arg.Pairs = map[string][]string{}
 	}
+	arg.Pairs["help"] = []string{"true"}
+}
 
-	// if we are dealing with possible tree then go down the tree.
-	if arg.Sub != nil {
-		return c.runSubCommand(arg.Sub, &childCtx)
+// checkMisplacedFlags returns an error if a flag provided before the
+// command name is not a flag of the program but one of the command, as
+// flags before the command only apply to the program.
+func checkMisplacedFlags(arg *argv.Argv, flags []Flag, cmd Command) error {
+	program := map[string]bool{}
+	for _, flag := range flags {
+		program[flag.FlagName()] = true
+		program[flag.FlagAlias()] = true
 	}
 
-	// if we are dealing with the final argv, then is the it's text
-	// value a command also, if it is, make a new chain and pass it on.
-	if _, ok := c.Commands[arg.Text]; ok {
-		arg.Sub = argv.New(arg.Text)
-		return c.runSubCommand(arg.Sub, &childCtx)
+	for _, flag := range cmd.Flags {
+		for _, key := range []string{flag.FlagName(), flag.FlagAlias()} {
+			if key != "" && !program[key] && arg.HasKV(key) {
+				return fmt.Errorf("flag %q of command %q must come after the command name", key, cmd.Name)
+			}
+		}
 	}
+	return nil
+}
 
-	cancel := func() {}
-	ctx := parent.Ctx()
-	if tm := childCtx.Duration("timeout"); childCtx.IsSet("timeout") {
-		childCtx.ctx, cancel = context.WithTimeout(ctx, tm)
+// Batch runs each of giving invocations, the arguments of a single run,
+// against the same program in order, as RunErr would with a fresh
+// context for each, returning the error of every invocation at its
+// index, such as for REPLs and script runners.
+func Batch(title string, flags []Flag, cmds []Command, invocations [][]string, ops ...RunOption) []error {
+	errs := make([]error, len(invocations))
+	for index, args := range invocations {
+		errs[index] = RunErr(title, flags, cmds, append(ops[:len(ops):len(ops)], WithArgs(args))...)
 	}
+	return errs
+}
 
-	defer cancel()
+// newRunConfig returns the run configuration from giving options.
+func newRunConfig(ops []RunOption) runConfig {
+	var args []string
+	if len(os.Args) > 1 {
+		args = os.Args[1:]
+	}
+
+	conf := runConfig{
+		args:    args,
+		exit:    os.Exit,
+		stdout:  os.Stdout,
+		stderr:  os.Stderr,
+		metrics: noopMetrics{},
+		keyring: systemKeyring{},
+	}
+	for _, op := range ops {
+		op(&conf)
+	}
 
-	return c.Action(&childCtx)
+	if conf.metrics == nil {
+		conf.metrics = noopMetrics{}
+	}
+	if conf.keyring == nil {
+		conf.keyring = noopKeyring{}
+	}
+	return conf
 }
 
-func (c *Command) runSubCommand(arg *argv.Argv, parent Context) error {
-	for _, sub := range c.Commands {
-		if sub.Name == arg.Name {
-			return sub.Run(arg, parent)
+// hasCommand returns true/false if a command with giving name
+// exists in the slice.
+func hasCommand(cmds []Command, name string) bool {
+	for _, cmd := range cmds {
+		if cmd.Name == name {
+			return true
 		}
 	}
-	return fmt.Errorf("%q has no subcommand named %q", c.Name, arg.Name)
+	return false
 }
 
-// Commands returns the passed in set of variadic arguments
-// returning them as a slice.
-func Commands(cmds ...Command) []Command {
-	return cmds
+// shadowableBuiltins lists the built-in flags left out of a run when the
+// program or any of its commands declares a flag of the same name or
+// alias, such that programs declaring their own keep working.
+var shadowableBuiltins = map[string]bool{"quiet": true, "dry-run": true, "timings": true}
+
+// withoutShadowed returns giving built-in flags without the shadowable
+// ones whose name or alias is declared by giving flags or the flags of
+// giving commands and their sub commands.
+func withoutShadowed(builtinFlags []Flag, flags []Flag, cmds []Command) []Flag {
+	declared := map[string]bool{}
+	declare := func(flags []Flag) {
+		for _, flag := range flags {
+			declared[flag.FlagName()] = true
+			if flag.FlagAlias() != "" {
+				declared[flag.FlagAlias()] = true
+			}
+		}
+	}
+	declare(flags)
+	Walk(cmds, func(_ []string, cmd Command) error {
+		declare(cmd.Flags)
+		return nil
+	})
+
+	kept := make([]Flag, 0, len(builtinFlags))
+	for _, flag := range builtinFlags {
+		if shadowableBuiltins[flag.FlagName()] && (declared[flag.FlagName()] || flag.FlagAlias() != "" && declared[flag.FlagAlias()]) {
+			continue
+		}
+		kept = append(kept, flag)
+	}
+	return kept
 }
 
-// Cmd returns a new Command from the provided options.
-func Cmd(name string, ops ...CommandFunc) Command {
-	cm := Command{
-		Stderr:   os.Stderr,
-		Stdout:   os.Stdout,
-		Commands: map[string]Command{},
-		Name:     strings.ToLower(name),
+// checkBuiltinFlags returns an error if the name or alias of any
+// of giving flags or the flags of giving commands and their sub
+// commands collides with those of the built-in flags.
+func checkBuiltinFlags(builtinFlags []Flag, flags []Flag, cmds []Command) error {
+	builtins := map[string]string{}
+	for _, flag := range builtinFlags {
+		builtins[flag.FlagName()] = flag.FlagName()
+		if flag.FlagAlias() != "" {
+			builtins[flag.FlagAlias()] = flag.FlagName()
+		}
 	}
 
-	for _, op := range ops {
-		op(&cm)
+	for _, flag := range flags {
+		for _, key := range []string{flag.FlagName(), flag.FlagAlias()} {
+			if builtin, ok := builtins[key]; ok && key != "" {
+				return fmt.Errorf("flag %q collides with built-in flag %q on %q", flag.FlagName(), builtin, key)
+			}
+		}
 	}
 
-	if tml, err := template.New("command.Usage").Funcs(defs).Parse(cmdUsageTml); err == nil {
-		var bu bytes.Buffer
-		if err := tml.Execute(&bu, struct {
-			Title    string
-			Cmd      Command
-			Commands map[string]Command
-		}{
-			Cmd:      cm,
-			Title:    cm.Name,
-			Commands: cm.Commands,
-		}); err != nil {
-			log.Fatalf("Error occured compiling command %q usage text: %q", cm.Name, err)
+	for _, cmd := range cmds {
+		subs := make([]Command, 0, len(cmd.Commands))
+		for _, sub := range cmd.Commands {
+			subs = append(subs, sub)
 		}
+		if err := checkBuiltinFlags(builtinFlags, cmd.Flags, subs); err != nil {
+			return fmt.Errorf("command %q: %s", cmd.Name, err)
+		}
+	}
+	return nil
+}
 
-		cm.CommandUsage = bu.String()
+// validateDefaults returns the first error of validating the defaults
+// of provided flags and the flags of the commands and their sub commands.
+func validateDefaults(flags []Flag, cmds []Command) error {
+	for _, flag := range flags {
+		if err := flag.ValidateDefault(); err != nil {
+			return err
+		}
 	}
 
-	if tml, err := template.New("flags.Usage").Funcs(defs).Parse(flagUsageTml); err == nil {
-		var bu bytes.Buffer
-		if err := tml.Execute(&bu, struct {
-			Title    string
-			Cmd      Command
-			Commands map[string]Command
-		}{
-			Cmd:      cm,
-			Title:    cm.Name,
-			Commands: cm.Commands,
-		}); err != nil {
-			log.Fatalf("Error occured compiling command %q flag usage text: %q", cm.Name, err)
+	for _, cmd := range cmds {
+		subs := make([]Command, 0, len(cmd.Commands))
+		for _, sub := range cmd.Commands {
+			subs = append(subs, sub)
+		}
+		if err := validateDefaults(cmd.Flags, subs); err != nil {
+			return fmt.Errorf("command %q: %s", cmd.Name, err)
 		}
+	}
+	return nil
+}
 
-		cm.FlagUsage = bu.String()
+// checkFlagCollisions returns an error if a name or alias of provided
+// flags, or of the flags of the commands and their sub commands, is used
+// by more than one flag of the same command, as their values would be
+// stored under the same key.
+func checkFlagCollisions(flags []Flag, cmds []Command) error {
+	keys := map[string]string{}
+	for _, flag := range flags {
+		for _, key := range []string{flag.FlagName(), flag.FlagAlias()} {
+			if key == "" {
+				continue
+			}
+			if other, ok := keys[key]; ok {
+				return fmt.Errorf("flag %q collides with flag %q on %q", flag.FlagName(), other, key)
+			}
+			keys[key] = flag.FlagName()
+		}
 	}
 
-	return cm
+	for _, cmd := range cmds {
+		subs := make([]Command, 0, len(cmd.Commands))
+		for _, sub := range cmd.Commands {
+			subs = append(subs, sub)
+		}
+		if err := checkFlagCollisions(cmd.Flags, subs); err != nil {
+			return fmt.Errorf("command %q: %s", cmd.Name, err)
+		}
+	}
+	return nil
 }
 
-// Run adds all commands and appropriate flags for each commands.
-// There is no need to call flag.Parse, has this calls it underneath and
-// parses appropriate commands.
-func Run(title string, flags []Flag, cmds []Command) {
+func run(title string, flags []Flag, cmds []Command, conf *runConfig) error {
+	// copy the provided slices, as appending into them could write into
+	// the backing array of the caller and race with concurrent calls.
+	flags = append([]Flag(nil), flags...)
+	cmds = append([]Command(nil), cmds...)
+
+	// a command tree containing itself would recurse forever below,
+	// while commands whose usage text failed to compile can't run.
+	if err := Walk(cmds, func(_ []string, cmd Command) error { return cmd.err }); err != nil {
+		return err
+	}
+
+	if conf.configCommand && !hasCommand(cmds, "config") {
+		cmds = append(cmds, configCommand(title, flags, cmds))
+	}
+
+	usage, flagOnlyUsage := usageTml, flagOnlyUsageTml
+	if conf.template != "" {
+		usage = conf.template
+	}
+
+	globalCmds := make([]Command, 0, len(cmds))
+	for _, cmd := range cmds {
+		globalCmds = append(globalCmds, globalCommand(cmd, flags))
+	}
+	cmds = globalCmds
+
+	if conf.plain {
+		usage, flagOnlyUsage = plainTemplate(usage), plainTemplate(flagOnlyUsage)
+
+		plainCmds := make([]Command, 0, len(cmds))
+		for _, cmd := range cmds {
+			plainCmds = append(plainCmds, plainCommand(cmd))
+		}
+		cmds = plainCmds
+	}
+
+	if conf.preserveCase {
+		preservedCmds := make([]Command, 0, len(cmds))
+		for _, cmd := range cmds {
+			preservedCmds = append(preservedCmds, preserveCaseCommand(cmd))
+		}
+		cmds = preservedCmds
+	}
+
+	builtins := []Flag{helpFlag, printFlag, timeoutFlag, timingsFlag, dryRunFlag, quietFlag}
+	if conf.version != "" {
+		builtins = append(builtins, versionFlag)
+	}
+	if conf.formats {
+		builtins = append(builtins, formatFlag, templateFlag)
+	}
+	builtins = withoutShadowed(builtins, flags, cmds)
+
+	if err := checkBuiltinFlags(builtins, flags, cmds); err != nil {
+		return err
+	}
+
+	if err := checkFlagCollisions(flags, cmds); err != nil {
+		return err
+	}
+
+	if err := validateDefaults(flags, cmds); err != nil {
+		return err
+	}
+
+	config, err := loadConfigFiles(conf.configFiles, conf.optionalConfig)
+	if err != nil {
+		return err
+	}
+	conf.config = config
+
+	dotEnv, err := loadDotEnvFiles(conf.dotEnvFiles)
+	if err != nil {
+		return err
+	}
+	conf.dotEnv = dotEnv
+
+	displayTitle, funcs := title, defs
+	if conf.preserveCase {
+		funcs = preserveCaseDefs()
+	}
+
 	title = strings.ToLower(title)
 	commands := map[string]Command{}
 
-	flags = append(flags, helpFlag)
-	flags = append(flags, printFlag)
-	flags = append(flags, timeoutFlag)
+	flags = append(flags, builtins...)
+	conf.builtins = builtins
 
 	// Register all flags first.
 	for _, cmd := range cmds {
@@ -1307,14 +4254,14 @@ func Run(title string, flags []Flag, cmds []Command) {
 	var cmdHelp string
 	var flagHelp string
 
-	tml, err := template.New("command.Usage").Funcs(defs).Parse(usageTml)
+	tml, err := template.New("command.Usage").Funcs(funcs).Parse(usage)
 	if err != nil {
-		log.Fatal("Failed to create template instance: ", err)
+		return fmt.Errorf("failed to create template instance: %s", err)
 	}
 
-	tmlflags, err := template.New("flags.Usage").Funcs(defs).Parse(flagOnlyUsageTml)
+	tmlflags, err := template.New("flags.Usage").Funcs(funcs).Parse(flagOnlyUsage)
 	if err != nil {
-		log.Fatal("Failed to create template instance: ", err)
+		return fmt.Errorf("failed to create template instance: %s", err)
 	}
 
 	var bu bytes.Buffer
@@ -1323,11 +4270,11 @@ func Run(title string, flags []Flag, cmds []Command) {
 		Commands []Command
 		Flags    []Flag
 	}{
-		Title:    title,
+		Title:    displayTitle,
 		Flags:    flags,
 		Commands: cmds,
 	}); err != nil {
-		log.Fatal("Failed to generated help message for command: ", err)
+		return fmt.Errorf("failed to generated help message for command: %s", err)
 	}
 	cmdHelp = bu.String()
 
@@ -1336,45 +4283,70 @@ func Run(title string, flags []Flag, cmds []Command) {
 		Title string
 		Flags []Flag
 	}{
-		Title: title,
+		Title: displayTitle,
 		Flags: flags,
 	}); err != nil {
-		log.Fatal("Failed to generated help message for command: ", err)
+		return fmt.Errorf("failed to generated help message for command: %s", err)
 	}
 	flagHelp = bu.String()
 
-	args := strings.Join(os.Args, " ")
-	carg, err := argv.Parse(args)
+	// the program name in os.Args[0] is never a command, so giving args
+	// are parsed beneath a root named after the title, with the first
+	// non-flag argument being the command.
+	args := append([]string{title}, conf.args...)
+	carg, err := argv.ParseArgsWithValues(args, valueFlags(flags, commands, conf))
 	if err != nil {
-		fmt.Fprint(os.Stderr, err.Error())
-		return
+		return &UsageError{Err: err, Usage: cmdHelp}
+	}
+	if conf.caseInsensitive {
+		lowerFlags(&carg)
 	}
+	resolveHelp(&carg, commands)
 
 	// if we are dealing with the final argv, then is the it's text
 	// value a command also, if it is, make a new chain and pass it on.
-	if _, ok := commands[carg.Text]; ok {
+	if _, _, ok := findCommand(commands, carg.Text); ok {
 		carg.Sub = argv.New(carg.Text)
 	}
 
 	if carg.HasKV("h") || carg.HasKV("help") {
-		fmt.Fprint(os.Stderr, cmdHelp)
-		return
+		if !conf.silent {
+			fmt.Fprint(conf.stderr, cmdHelp)
+		}
+		return ErrHelp
 	}
 
 	if carg.HasKV("flags") {
-		fmt.Fprint(os.Stderr, flagHelp)
-		return
+		if !conf.silent {
+			fmt.Fprint(conf.stderr, flagHelp)
+		}
+		return ErrHelp
+	}
+
+	if carg.HasKV("version") && conf.version != "" {
+		if !conf.silent {
+			fmt.Fprintf(conf.stdout, "%s %s\n", title, conf.version)
+		}
+		return ErrVersion
+	}
+
+	if carg.Sub == nil && carg.Text != "" {
+		return &UsageError{Err: fmt.Errorf("command not found %q", carg.Text), Usage: cmdHelp}
 	}
 
 	if carg.Sub == nil {
-		fmt.Fprint(os.Stderr, cmdHelp)
-		return
+		fmt.Fprint(conf.stderr, cmdHelp)
+		return nil
 	}
 
-	target, ok := commands[carg.Sub.Name]
+	target, preset, ok := findCommand(commands, carg.Sub.Name)
 	if !ok {
-		fmt.Fprint(os.Stderr, fmt.Errorf("command not found %q", carg.Name))
-		return
+		return &UsageError{Err: fmt.Errorf("command not found %q", carg.Sub.Name), Usage: cmdHelp}
+	}
+	applyPreset(carg.Sub, preset)
+
+	if err := checkMisplacedFlags(&carg, flags, target); err != nil {
+		return &UsageError{Err: err, Usage: cmdHelp}
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -1382,23 +4354,54 @@ func Run(title string, flags []Flag, cmds []Command) {
 
 	var cmdCtx ctxImpl
 	cmdCtx.ctx = ctx
+	cmdCtx.cancel = cancel
+	cmdCtx.conf = conf
+	cmdCtx.raw = &carg
+	cmdCtx.stdout = conf.stdout
+	cmdCtx.stderr = conf.stderr
 	if err := cmdCtx.process(&carg, flags); err != nil {
-		fmt.Fprint(os.Stderr, err)
-		return
+		return &UsageError{Err: err, Usage: cmdHelp}
 	}
 
-	ch := make(chan os.Signal, 3)
-	signal.Notify(ch, os.Interrupt)
-	signal.Notify(ch, syscall.SIGQUIT)
-	signal.Notify(ch, syscall.SIGTERM)
+	// SIGHUP is only handled when a reload handler was provided, leaving
+	// it to terminate the process otherwise.
+	signals := conf.signals
+	if signals == nil {
+		ch := make(chan os.Signal, 3)
+		signal.Notify(ch, os.Interrupt, syscall.SIGQUIT, syscall.SIGTERM)
+		if conf.reload != nil {
+			signal.Notify(ch, syscall.SIGHUP)
+		}
+		defer signal.Stop(ch)
+		signals = ch
+	}
 
+	done := make(chan error, 1)
 	go func() {
-		defer close(ch)
-		if err := target.Run(carg.Sub, &cmdCtx); err != nil {
-			fmt.Fprint(os.Stderr, err.Error())
-			return
-		}
+		done <- target.Run(carg.Sub, &cmdCtx)
 	}()
 
-	<-ch
+	for {
+		select {
+		case err := <-done:
+			return err
+		case sig := <-signals:
+			if sig == syscall.SIGHUP && conf.reload != nil {
+				if err := conf.reload(&cmdCtx); err != nil {
+					fmt.Fprintf(conf.stderr, "reload failed: %s\n", err)
+				}
+				continue
+			}
+
+			// the command observes the signal through the cancellation
+			// of its context, while another signal stops waiting for it.
+			cancel()
+			select {
+			case err := <-done:
+				return err
+			case <-signals:
+				return nil
+			}
+		}
+	}
 }
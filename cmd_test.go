@@ -1,8 +1,20 @@
 package cmdkit_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"text/template"
 	"time"
 
 	"github.com/gokit/cmdkit"
@@ -25,11 +37,21 @@ func TestFlagParsing(t *testing.T) {
 			Value:    []string{"wallet", "river"},
 			Expected: []string{"wallet", "river"},
 		},
+		{
+			Type:     cmdkit.StringList,
+			Value:    []string{"wallet,river"},
+			Expected: []string{"wallet", "river"},
+		},
 		{
 			Type:     cmdkit.BoolList,
 			Value:    []string{"false", "true"},
 			Expected: []bool{false, true},
 		},
+		{
+			Type:     cmdkit.IntList,
+			Value:    []string{"1,2,3"},
+			Expected: []int{1, 2, 3},
+		},
 		{
 			Type:     cmdkit.Bool,
 			Value:    []string{"true"},
@@ -60,11 +82,61 @@ func TestFlagParsing(t *testing.T) {
 			Value:    []string{"1", "2"},
 			Expected: []int{1, 2},
 		},
+		{
+			Type:     cmdkit.Int,
+			Value:    []string{"42"},
+			Expected: 42,
+		},
+		{
+			Type:     cmdkit.Int,
+			Value:    []string{"0xFF"},
+			Expected: 255,
+		},
+		{
+			Type:     cmdkit.Int,
+			Value:    []string{"0b101"},
+			Expected: 5,
+		},
+		{
+			Type:     cmdkit.Int,
+			Value:    []string{"1_000"},
+			Expected: 1000,
+		},
+		{
+			Type:     cmdkit.Int,
+			Value:    []string{"1x0"},
+			MustFail: true,
+		},
+		{
+			Type:     cmdkit.IntList,
+			Value:    []string{"0x10", "0b11", "1_000"},
+			Expected: []int{16, 3, 1000},
+		},
 		{
 			Type:     cmdkit.Int8,
 			Value:    []string{"1"},
 			Expected: int8(1),
 		},
+		{
+			Type:     cmdkit.Int8,
+			Value:    []string{"0x7F"},
+			Expected: int8(127),
+		},
+		{
+			Type:     cmdkit.Int16,
+			Value:    []string{"0b101"},
+			Expected: int16(5),
+		},
+		{
+			Type:     cmdkit.Int32,
+			Value:    []string{"1_000"},
+			Expected: int32(1000),
+		},
+		{
+			Type:     cmdkit.Int64,
+			Value:    []string{"0xFF"},
+			Expected: int64(255),
+		},
 		{
 			Type:     cmdkit.Int16,
 			Value:    []string{"1"},
@@ -457,3 +529,2961 @@ func TestFlagParsing(t *testing.T) {
 		}
 	}
 }
+
+func TestPlainHelp(t *testing.T) {
+	var out bytes.Buffer
+	cmdkit.Run("example", cmdkit.Flags(
+		cmdkit.IntFlag(cmdkit.FlagName("age")),
+	), cmdkit.Commands(
+		cmdkit.Cmd("add", cmdkit.Desc("displays a add message")),
+	), cmdkit.WithPlainHelp(), cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"--help"}))
+
+	if out.Len() == 0 {
+		t.Fatal("Should have printed help message")
+	}
+	if strings.ContainsAny(out.String(), "⡿⠙") {
+		t.Fatalf("Should not contain braille glyphs: %q", out.String())
+	}
+	if !strings.Contains(out.String(), "FLAGS:") {
+		t.Fatalf("Should contain ascii headers: %q", out.String())
+	}
+
+	out.Reset()
+	add := cmdkit.Cmd("add", cmdkit.Desc("displays a add message"))
+	add.Stderr = &out
+
+	cmdkit.Run("example", nil, cmdkit.Commands(add), cmdkit.WithPlainHelp(), cmdkit.WithArgs([]string{"add", "--help"}))
+
+	if !strings.Contains(out.String(), "Command: add") {
+		t.Fatalf("Should have printed command help: %q", out.String())
+	}
+	if strings.ContainsAny(out.String(), "⡿⠙") {
+		t.Fatalf("Should not contain braille glyphs: %q", out.String())
+	}
+}
+
+type recordedCommand struct {
+	path []string
+	dur  time.Duration
+	err  error
+}
+
+type recordingSink struct {
+	records []recordedCommand
+}
+
+func (r *recordingSink) RecordCommand(path []string, dur time.Duration, err error) {
+	r.records = append(r.records, recordedCommand{path: path, dur: dur, err: err})
+}
+
+func TestMetricsSink(t *testing.T) {
+	var sink recordingSink
+	cmdkit.Run("example", nil, cmdkit.Commands(
+		cmdkit.Cmd(
+			"add",
+			cmdkit.WithAction(func(ctx cmdkit.Context) error {
+				return nil
+			}),
+			cmdkit.SubCommands(
+				cmdkit.Cmd(
+					"broc",
+					cmdkit.WithAction(func(ctx cmdkit.Context) error {
+						time.Sleep(time.Millisecond)
+						return nil
+					}),
+				),
+			),
+		),
+	), cmdkit.WithMetrics(&sink), cmdkit.WithArgs([]string{"add", "broc"}))
+
+	if len(sink.records) != 1 {
+		t.Fatalf("Should have recorded one command: %#v", sink.records)
+	}
+
+	record := sink.records[0]
+	if !reflect.DeepEqual(record.path, []string{"add", "broc"}) {
+		t.Fatalf("Should have recorded command path: %#v", record.path)
+	}
+	if record.dur < time.Millisecond {
+		t.Fatalf("Should have recorded command duration: %s", record.dur)
+	}
+	if record.err != nil {
+		t.Fatalf("Should have recorded no error: %s", record.err)
+	}
+}
+
+func TestRunExit(t *testing.T) {
+	var out bytes.Buffer
+	var code int
+	cmdkit.Run("example", nil, cmdkit.Commands(
+		cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			return errors.New("failed to add")
+		})),
+	), cmdkit.WithStderr(&out), cmdkit.WithExit(func(c int) {
+		code = c
+	}), cmdkit.WithArgs([]string{"remove"}))
+
+	if code != 2 {
+		t.Fatalf("Should have exited with code 2: %d", code)
+	}
+	if !strings.Contains(out.String(), `command not found "remove"`) {
+		t.Fatalf("Should have printed error: %q", out.String())
+	}
+
+	code = 0
+	out.Reset()
+	cmdkit.Run("example", nil, cmdkit.Commands(
+		cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			return errors.New("failed to add")
+		})),
+	), cmdkit.WithStderr(&out), cmdkit.WithExit(func(c int) {
+		code = c
+	}), cmdkit.WithArgs([]string{"add"}))
+
+	if code != 1 {
+		t.Fatalf("Should have exited with code 1: %d", code)
+	}
+	if !strings.Contains(out.String(), "failed to add") {
+		t.Fatalf("Should have printed error: %q", out.String())
+	}
+}
+
+func TestBuiltinFlagCollisions(t *testing.T) {
+	var suite = []struct {
+		Flag    cmdkit.Flag
+		Message string
+	}{
+		{
+			Flag:    cmdkit.BoolFlag(cmdkit.FlagName("help")),
+			Message: `flag "help" collides with built-in flag "help" on "help"`,
+		},
+		{
+			Flag:    cmdkit.StringFlag(cmdkit.FlagName("host"), cmdkit.FlagAlias("h")),
+			Message: `flag "host" collides with built-in flag "help" on "h"`,
+		},
+		{
+			Flag:    cmdkit.StringFlag(cmdkit.FlagName("flags")),
+			Message: `flag "flags" collides with built-in flag "flags" on "flags"`,
+		},
+		{
+			Flag:    cmdkit.IntFlag(cmdkit.FlagName("timeout")),
+			Message: `flag "timeout" collides with built-in flag "timeout" on "timeout"`,
+		},
+		{
+			Flag:    cmdkit.StringFlag(cmdkit.FlagName("theme"), cmdkit.FlagAlias("tm")),
+			Message: `flag "theme" collides with built-in flag "timeout" on "tm"`,
+		},
+	}
+
+	for _, tcase := range suite {
+		var out bytes.Buffer
+		var code int
+		cmdkit.Run("example", cmdkit.Flags(tcase.Flag), nil, cmdkit.WithStderr(&out), cmdkit.WithExit(func(c int) {
+			code = c
+		}), cmdkit.WithArgs(nil))
+
+		if code != 1 {
+			t.Fatalf("Should have exited with code 1 for %q: %d", tcase.Flag.Name, code)
+		}
+		if !strings.Contains(out.String(), tcase.Message) {
+			t.Fatalf("Should have printed collision error %q: %q", tcase.Message, out.String())
+		}
+	}
+
+	broc := cmdkit.Cmd("broc")
+	broc.Flags = cmdkit.Flags(cmdkit.BoolFlag(cmdkit.FlagName("help")))
+
+	var out bytes.Buffer
+	var code int
+	cmdkit.Run("example", nil, cmdkit.Commands(
+		cmdkit.Cmd("add", cmdkit.SubCommands(broc)),
+	), cmdkit.WithStderr(&out), cmdkit.WithExit(func(c int) {
+		code = c
+	}), cmdkit.WithArgs(nil))
+
+	if code != 1 {
+		t.Fatalf("Should have exited with code 1: %d", code)
+	}
+	if !strings.Contains(out.String(), `command "add": command "broc": flag "help" collides`) {
+		t.Fatalf("Should have printed collision error: %q", out.String())
+	}
+}
+
+func TestContextPrintf(t *testing.T) {
+	var out bytes.Buffer
+	add := cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		ctx.Printf("Welcome to add: %q\n", ctx.String("name"))
+		ctx.Println("done")
+		return nil
+	}))
+	add.Stdout = &out
+
+	cmdkit.Run("example", cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("name")),
+	), cmdkit.Commands(add), cmdkit.WithArgs([]string{"--name=wallet", "add"}))
+
+	if out.String() != "Welcome to add: \"wallet\"\ndone\n" {
+		t.Fatalf("Should have written to command stdout: %q", out.String())
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	var name, home string
+	add := cmdkit.Cmd("add", cmdkit.WithEnv(map[string]string{
+		"CMDKIT_TEST_NAME": "wallet",
+	}), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		name = ctx.String("name")
+		home = ctx.Getenv("CMDKIT_TEST_NAME")
+		return nil
+	}))
+	add.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("name"), cmdkit.Env("CMDKIT_TEST_NAME")))
+
+	cmdkit.Run("example", nil, cmdkit.Commands(add), cmdkit.WithArgs([]string{"add"}))
+
+	if name != "wallet" {
+		t.Fatalf("Should have resolved flag from command env: %q", name)
+	}
+	if home != "wallet" {
+		t.Fatalf("Should have resolved Getenv from command env: %q", home)
+	}
+	if _, ok := os.LookupEnv("CMDKIT_TEST_NAME"); ok {
+		t.Fatal("Should not have modified process environment")
+	}
+}
+
+func TestContextCommand(t *testing.T) {
+	var name, desc string
+	cmdkit.Run("example", nil, cmdkit.Commands(
+		cmdkit.Cmd("add", cmdkit.Desc("displays a add message"), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			name = ctx.Command().Name
+			desc = ctx.Command().Desc
+			return nil
+		})),
+	), cmdkit.WithArgs([]string{"add"}))
+
+	if name != "add" {
+		t.Fatalf("Should have received executing command: %q", name)
+	}
+	if desc != "displays a add message" {
+		t.Fatalf("Should have received executing command desc: %q", desc)
+	}
+}
+
+func TestFlagParseError(t *testing.T) {
+	flag := cmdkit.IntFlag(cmdkit.FlagName("age"), cmdkit.ParseError("age must be a whole number"))
+	if _, err := flag.Parse("twenty"); err == nil || err.Error() != "age must be a whole number" {
+		t.Fatalf("Should have returned custom parse error: %v", err)
+	}
+
+	received, err := flag.Parse("20")
+	if err != nil {
+		t.Fatalf("Should not have failed: %+q\n", err)
+	}
+	if received != 20 {
+		t.Fatalf("Should have parsed value: %#v", received)
+	}
+}
+
+func TestFlagParseErrorMessages(t *testing.T) {
+	var suite = []struct {
+		Flag    cmdkit.Flag
+		Value   []string
+		Message string
+	}{
+		{
+			Flag:    cmdkit.DurationFlag(cmdkit.FlagName("delay")),
+			Value:   []string{"5x"},
+			Message: `flag "delay": "5x" is not a valid duration`,
+		},
+		{
+			Flag:    cmdkit.Float64Flag(cmdkit.FlagName("ratio")),
+			Value:   []string{"half"},
+			Message: `flag "ratio": "half" is not a valid float64`,
+		},
+		{
+			Flag:    cmdkit.Float32Flag(cmdkit.FlagName("ratio")),
+			Value:   []string{"half"},
+			Message: `flag "ratio": "half" is not a valid float32`,
+		},
+		{
+			Flag:    cmdkit.Int8Flag(cmdkit.FlagName("level")),
+			Value:   []string{"300"},
+			Message: `flag "level": "300" is not a valid int8`,
+		},
+		{
+			Flag:    cmdkit.IntFlag(cmdkit.FlagName("age")),
+			Value:   []string{"twenty"},
+			Message: `flag "age": "twenty" is not a valid int`,
+		},
+		{
+			Flag:    cmdkit.BoolFlag(cmdkit.FlagName("verbose")),
+			Value:   []string{"yep"},
+			Message: `flag "verbose": "yep" is not a valid bool`,
+		},
+		{
+			Flag:    cmdkit.DurationListFlag(cmdkit.FlagName("delays")),
+			Value:   []string{"2s", "5x"},
+			Message: `flag "delays": "5x" is not a valid duration`,
+		},
+	}
+
+	for _, tcase := range suite {
+		_, err := tcase.Flag.Parse(tcase.Value[0], tcase.Value[1:]...)
+		if err == nil {
+			t.Fatalf("Should have failed parsing %q", tcase.Value)
+		}
+		if err.Error() != tcase.Message {
+			t.Logf("Recieved: %q\n", err.Error())
+			t.Logf("Expected: %q\n", tcase.Message)
+			t.Fatal("Should match expected")
+		}
+	}
+}
+
+func TestPositionalsWithSubCommands(t *testing.T) {
+	var listed bool
+	var files []string
+	cmds := cmdkit.Commands(
+		cmdkit.Cmd(
+			"show",
+			cmdkit.WithAction(func(ctx cmdkit.Context) error {
+				files = ctx.Args()
+				return nil
+			}),
+			cmdkit.SubCommands(
+				cmdkit.Cmd("list", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+					listed = true
+					return nil
+				})),
+			),
+		),
+	)
+
+	cmdkit.Run("example", nil, cmds, cmdkit.WithArgs([]string{"show", "list"}))
+	if !listed {
+		t.Fatal("Should have executed list sub command")
+	}
+	if files != nil {
+		t.Fatalf("Should not have executed show command: %#v", files)
+	}
+
+	listed = false
+	cmdkit.Run("example", nil, cmds, cmdkit.WithArgs([]string{"show", "file.txt"}))
+	if listed {
+		t.Fatal("Should not have executed list sub command")
+	}
+	if !reflect.DeepEqual(files, []string{"file.txt"}) {
+		t.Fatalf("Should have received positional argument: %#v", files)
+	}
+
+	cmdkit.Run("example", nil, cmds, cmdkit.WithArgs([]string{"show", "file.txt", "list"}))
+	if listed {
+		t.Fatal("Should not have executed list sub command")
+	}
+	if !reflect.DeepEqual(files, []string{"file.txt", "list"}) {
+		t.Fatalf("Should have received positional arguments: %#v", files)
+	}
+}
+
+func TestRunSkipsProgramName(t *testing.T) {
+	var executed bool
+	cmds := cmdkit.Commands(
+		cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			executed = true
+			return nil
+		})),
+	)
+
+	var out bytes.Buffer
+	cmdkit.Run("example", nil, cmds, cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"add"}))
+	if !executed {
+		t.Fatal("Should have executed first argument as command")
+	}
+	if out.Len() != 0 {
+		t.Fatalf("Should not have printed help: %q", out.String())
+	}
+
+	executed = false
+	cmdkit.Run("example", nil, cmds, cmdkit.WithStderr(&out), cmdkit.WithArgs(nil))
+	if executed {
+		t.Fatal("Should not have executed command without arguments")
+	}
+	if !strings.Contains(out.String(), "Usage: example") {
+		t.Fatalf("Should have printed help: %q", out.String())
+	}
+}
+
+func TestContextArgv(t *testing.T) {
+	var pairs map[string][]string
+	var text string
+	cmdkit.Run("example", nil, cmdkit.Commands(
+		cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			pairs = ctx.Argv().Pairs
+			text = ctx.Argv().Text
+			return nil
+		})),
+	), cmdkit.WithArgs([]string{"add", "--bogus=wallet", "file.txt"}))
+
+	if !reflect.DeepEqual(pairs["bogus"], []string{"wallet"}) {
+		t.Fatalf("Should have received undeclared flag: %#v", pairs)
+	}
+	if text != "file.txt" {
+		t.Fatalf("Should have received positional text: %q", text)
+	}
+}
+
+func TestContextRemainder(t *testing.T) {
+	var remainder []string
+	cmdkit.Run("example", nil, cmdkit.Commands(
+		cmdkit.Cmd("run", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			remainder = ctx.Remainder()
+			return nil
+		})),
+	), cmdkit.WithArgs([]string{"run", "--", "echo", "--help", "world"}))
+
+	if !reflect.DeepEqual(remainder, []string{"echo", "--help", "world"}) {
+		t.Fatalf("Should have received remainder untouched: %#v", remainder)
+	}
+}
+
+func TestEnumFlag(t *testing.T) {
+	const (
+		stream = iota + 1
+		datagram
+	)
+
+	flag := cmdkit.EnumFlag(map[string]interface{}{
+		"tcp": stream,
+		"udp": datagram,
+	}, cmdkit.FlagName("proto"))
+
+	received, err := flag.Parse("udp")
+	if err != nil {
+		t.Fatalf("Should not have failed: %+q\n", err)
+	}
+	if received != datagram {
+		t.Fatalf("Should have mapped value: %#v", received)
+	}
+
+	if _, err := flag.Parse("icmp"); err == nil || err.Error() != `flag "proto": "icmp" is not one of tcp, udp` {
+		t.Fatalf("Should have listed valid keys: %v", err)
+	}
+
+	var proto interface{}
+	cmdkit.Run("example", cmdkit.Flags(flag), cmdkit.Commands(
+		cmdkit.Cmd("dial", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			proto = ctx.Enum("proto")
+			return nil
+		})),
+	), cmdkit.WithArgs([]string{"--proto=tcp", "dial"}))
+
+	if proto != stream {
+		t.Fatalf("Should have received mapped value from context: %#v", proto)
+	}
+}
+
+func TestCommandWithoutWriters(t *testing.T) {
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatalf("Should have created stderr file: %+q\n", err)
+	}
+	defer stderr.Close()
+
+	original := os.Stderr
+	os.Stderr = stderr
+	defer func() {
+		os.Stderr = original
+	}()
+
+	cmdkit.Run("example", nil, cmdkit.Commands(cmdkit.Command{
+		Name:         "raw",
+		CommandUsage: "raw usage",
+	}), cmdkit.WithArgs([]string{"raw", "--help"}))
+
+	os.Stderr = original
+	content, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatalf("Should have read stderr file: %+q\n", err)
+	}
+	if string(content) != "raw usage" {
+		t.Fatalf("Should have printed usage to process stderr: %q", content)
+	}
+}
+
+func TestDeprecatedCommand(t *testing.T) {
+	var out bytes.Buffer
+	var executed bool
+	foo := cmdkit.Cmd("foo", cmdkit.DeprecatedCommand(`use "bar"`), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		executed = true
+		return nil
+	}))
+	foo.Stderr = &out
+
+	cmdkit.Run("example", nil, cmdkit.Commands(foo), cmdkit.WithArgs([]string{"foo"}))
+	if !executed {
+		t.Fatal("Should have executed deprecated command")
+	}
+	if out.String() != "command \"foo\" is deprecated: use \"bar\"\n" {
+		t.Fatalf("Should have printed deprecation warning: %q", out.String())
+	}
+
+	out.Reset()
+	cmdkit.Run("example", nil, cmdkit.Commands(foo), cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"--help"}))
+	if !strings.Contains(out.String(), "foo        (deprecated)") {
+		t.Fatalf("Should have marked command as deprecated in help: %q", out.String())
+	}
+}
+
+func TestFlagObserver(t *testing.T) {
+	type observed struct {
+		value  interface{}
+		source string
+	}
+
+	seen := map[string]observed{}
+	add := cmdkit.Cmd("add", cmdkit.WithEnv(map[string]string{
+		"CMDKIT_TEST_TOKEN": "s3cr3t",
+	}), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+	add.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("token"), cmdkit.Env("CMDKIT_TEST_TOKEN"), cmdkit.Secret()),
+		cmdkit.IntFlag(cmdkit.FlagName("retries"), cmdkit.Default(3)),
+	)
+
+	cmdkit.Run("example", cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("name")),
+	), cmdkit.Commands(add), cmdkit.WithFlagObserver(func(name string, value interface{}, source string) {
+		seen[name] = observed{value: value, source: source}
+	}), cmdkit.WithArgs([]string{"--name=wallet", "add"}))
+
+	expected := map[string]observed{
+		"name":    {value: "wallet", source: cmdkit.SourceFlag},
+		"token":   {value: "******", source: cmdkit.SourceEnv},
+		"retries": {value: 3, source: cmdkit.SourceDefault},
+		"help":    {value: false, source: cmdkit.SourceDefault},
+		"flags":   {value: false, source: cmdkit.SourceDefault},
+		"timings": {value: false, source: cmdkit.SourceDefault},
+		"dry-run": {value: false, source: cmdkit.SourceDefault},
+		"quiet":   {value: false, source: cmdkit.SourceDefault},
+	}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Logf("Recieved: %#v\n", seen)
+		t.Logf("Expected: %#v\n", expected)
+		t.Fatal("Should match expected")
+	}
+}
+
+func TestCommaListFlagWithSubCommand(t *testing.T) {
+	var tags, args []string
+	cmdkit.Run("example", cmdkit.Flags(
+		cmdkit.StringListFlag(cmdkit.FlagName("tags")),
+	), cmdkit.Commands(
+		cmdkit.Cmd("push", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			value, _ := ctx.Get("tags")
+			tags = value.([]string)
+			args = ctx.Args()
+			return nil
+		})),
+	), cmdkit.WithArgs([]string{"--tags=a,b", "push", "origin"}))
+
+	if !reflect.DeepEqual(tags, []string{"a", "b"}) {
+		t.Fatalf("Should have split comma separated list: %#v", tags)
+	}
+	if !reflect.DeepEqual(args, []string{"origin"}) {
+		t.Fatalf("Should have kept following tokens as positionals: %#v", args)
+	}
+}
+
+func TestSpacedCommaListFlagWithSubCommand(t *testing.T) {
+	var tags, args []string
+	var pushed bool
+	err := cmdkit.RunErr("example", cmdkit.Flags(
+		cmdkit.StringListFlag(cmdkit.FlagName("tags")),
+	), cmdkit.Commands(
+		cmdkit.Cmd("push", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			pushed = true
+			tags = ctx.StringSliceUnique("tags")
+			args = ctx.Args()
+			return nil
+		})),
+	), cmdkit.WithArgs([]string{"--tags", "a,b", "push", "origin"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+
+	if !pushed {
+		t.Fatal("Should have kept push as the sub command")
+	}
+	if !reflect.DeepEqual(tags, []string{"a", "b"}) {
+		t.Fatalf("Should have split comma separated list: %#v", tags)
+	}
+	if !reflect.DeepEqual(args, []string{"origin"}) {
+		t.Fatalf("Should have kept following tokens as positionals: %#v", args)
+	}
+}
+
+func TestRunNoExit(t *testing.T) {
+	var out bytes.Buffer
+	var exited bool
+	exit := cmdkit.WithExit(func(int) {
+		exited = true
+	})
+
+	cmds := cmdkit.Commands(
+		cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			return errors.New("failed to add")
+		})),
+	)
+
+	err := cmdkit.Run("example", nil, cmds, cmdkit.WithNoExit(), exit, cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"--help"}))
+	if err != cmdkit.ErrHelp {
+		t.Fatalf("Should have returned ErrHelp: %v", err)
+	}
+	if !strings.Contains(out.String(), "Usage: example") {
+		t.Fatalf("Should have printed help: %q", out.String())
+	}
+
+	err = cmdkit.Run("example", nil, cmds, cmdkit.WithNoExit(), exit, cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"add", "--help"}))
+	if err != cmdkit.ErrHelp {
+		t.Fatalf("Should have returned ErrHelp for command help: %v", err)
+	}
+
+	err = cmdkit.Run("example", nil, cmds, cmdkit.WithNoExit(), exit, cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"add"}))
+	if err == nil || err.Error() != "failed to add" {
+		t.Fatalf("Should have returned action error: %v", err)
+	}
+	if exited {
+		t.Fatal("Should not have exited")
+	}
+
+	err = cmdkit.Run("example", nil, cmds, exit, cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"--help"}))
+	if err != nil {
+		t.Fatalf("Should not have returned ErrHelp without WithNoExit: %v", err)
+	}
+
+	usage := cmdkit.Cmd("usage", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		ctx.PrintHelp()
+		return fmt.Errorf("command %q: %w", "usage", cmdkit.ErrHelp)
+	}))
+	err = cmdkit.Run("example", nil, cmdkit.Commands(usage), exit, cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"usage"}))
+	if err != nil || exited {
+		t.Fatalf("Should not have exited with wrapped ErrHelp: %v", err)
+	}
+}
+
+func TestRunErrSentinels(t *testing.T) {
+	var out bytes.Buffer
+	cmds := cmdkit.Commands(
+		cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			return nil
+		})),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmds, cmdkit.WithStderr(&out), cmdkit.WithStdout(&out), cmdkit.WithArgs([]string{"--help"}))
+	if !errors.Is(err, cmdkit.ErrHelp) {
+		t.Fatalf("Should have returned ErrHelp: %v", err)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmds, cmdkit.WithStderr(&out), cmdkit.WithStdout(&out), cmdkit.WithArgs([]string{"add", "-h"}))
+	if !errors.Is(err, cmdkit.ErrHelp) {
+		t.Fatalf("Should have returned ErrHelp for command help: %v", err)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmds, cmdkit.WithVersion("1.0.0"), cmdkit.WithStderr(&out), cmdkit.WithStdout(&out), cmdkit.WithArgs([]string{"--version"}))
+	if !errors.Is(err, cmdkit.ErrVersion) {
+		t.Fatalf("Should have returned ErrVersion: %v", err)
+	}
+
+	if out.Len() != 0 {
+		t.Fatalf("Should not have printed anything: %q", out.String())
+	}
+
+	err = cmdkit.Run("example", nil, cmds, cmdkit.WithNoExit(), cmdkit.WithVersion("1.0.0"), cmdkit.WithStdout(&out), cmdkit.WithArgs([]string{"--version"}))
+	if !errors.Is(err, cmdkit.ErrVersion) {
+		t.Fatalf("Should have returned ErrVersion: %v", err)
+	}
+	if out.String() != "example 1.0.0\n" {
+		t.Fatalf("Should have printed version: %q", out.String())
+	}
+}
+
+func TestCommandFlagDefaultOverridesGlobal(t *testing.T) {
+	var region, globalRegion string
+	deploy := cmdkit.Cmd("deploy", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		region = ctx.String("region")
+		globalRegion = ctx.Parent().String("region")
+		return nil
+	}))
+	deploy.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("region"), cmdkit.Default("eu")))
+
+	globals := cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("region"), cmdkit.Default("us")))
+
+	cmdkit.Run("example", globals, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"deploy"}))
+	if region != "eu" {
+		t.Fatalf("Should have used command default: %q", region)
+	}
+	if globalRegion != "us" {
+		t.Fatalf("Should have kept global default on parent: %q", globalRegion)
+	}
+
+	cmdkit.Run("example", globals, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"--region=ap", "deploy"}))
+	if region != "ap" {
+		t.Fatalf("Should have used explicit global value: %q", region)
+	}
+
+	cmdkit.Run("example", globals, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"--region=ap", "deploy", "--region=af"}))
+	if region != "af" {
+		t.Fatalf("Should have used explicit command value: %q", region)
+	}
+}
+
+func TestCommandAliasPreset(t *testing.T) {
+	var env string
+	var executed int
+	deploy := cmdkit.Cmd("deploy", cmdkit.Alias("prod", map[string]string{
+		"env": "production",
+	}), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		executed++
+		env = ctx.String("env")
+		return nil
+	}))
+	deploy.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("env"), cmdkit.Default("staging")))
+
+	cmdkit.Run("example", nil, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"prod"}))
+	if env != "production" {
+		t.Fatalf("Should have applied alias preset: %q", env)
+	}
+
+	cmdkit.Run("example", nil, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"prod", "--env=qa"}))
+	if env != "qa" {
+		t.Fatalf("Should have overridden alias preset: %q", env)
+	}
+
+	cmdkit.Run("example", nil, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"deploy"}))
+	if env != "staging" {
+		t.Fatalf("Should not have applied alias preset for command name: %q", env)
+	}
+
+	cmdkit.Run("example", nil, cmdkit.Commands(
+		cmdkit.Cmd("app", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			return nil
+		}), cmdkit.SubCommands(deploy)),
+	), cmdkit.WithArgs([]string{"app", "prod"}))
+	if env != "production" {
+		t.Fatalf("Should have applied alias preset of sub command: %q", env)
+	}
+	if executed != 4 {
+		t.Fatalf("Should have executed command for every run: %d", executed)
+	}
+}
+
+func TestTimeoutFromEnv(t *testing.T) {
+	t.Setenv("CMDKIT_TIMEOUT", "5s")
+
+	var remaining time.Duration
+	var hasDeadline bool
+	cmds := cmdkit.Commands(
+		cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			var deadline time.Time
+			deadline, hasDeadline = ctx.Ctx().Deadline()
+			remaining = time.Until(deadline)
+			return nil
+		})),
+	)
+
+	cmdkit.Run("example", nil, cmds, cmdkit.WithArgs([]string{"add"}))
+	if !hasDeadline {
+		t.Fatal("Should have set context deadline from env")
+	}
+	if remaining > 5*time.Second || remaining < 4*time.Second {
+		t.Fatalf("Should have used timeout from env: %s", remaining)
+	}
+
+	cmdkit.Run("example", nil, cmds, cmdkit.WithArgs([]string{"--timeout=1m", "add"}))
+	if remaining > time.Minute || remaining < 59*time.Second {
+		t.Fatalf("Should have used timeout from flag over env: %s", remaining)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	var observed bool
+	cmdkit.Run("example", nil, cmdkit.Commands(
+		cmdkit.Cmd("watch", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				<-ctx.Ctx().Done()
+				observed = true
+			}()
+
+			ctx.Cancel()
+
+			select {
+			case <-done:
+				return nil
+			case <-time.After(time.Second):
+				return errors.New("context was not cancelled")
+			}
+		})),
+	), cmdkit.WithArgs([]string{"watch"}))
+
+	if !observed {
+		t.Fatal("Should have observed cancellation of context")
+	}
+}
+
+func TestFlagValueWithAssignment(t *testing.T) {
+	var query string
+	cmdkit.Run("example", cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("query"))), cmdkit.Commands(
+		cmdkit.Cmd("search", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			query = ctx.String("query")
+			return nil
+		})),
+	), cmdkit.WithArgs([]string{"--query=a=b=c", "search"}))
+
+	if query != "a=b=c" {
+		t.Fatalf("Should have kept value after first assignment: %q", query)
+	}
+}
+
+func TestMalformedTemplates(t *testing.T) {
+	if _, err := cmdkit.CmdE("add", cmdkit.UsageTemplate("{{ .Cmd.Name ")); err == nil {
+		t.Fatal("Should have failed to parse command template")
+	}
+
+	if _, err := cmdkit.CmdE("add", cmdkit.UsageTemplate("{{ .Cmd.Missing }}")); err == nil {
+		t.Fatal("Should have failed to execute command template")
+	}
+
+	cmd, err := cmdkit.CmdE("add", cmdkit.UsageTemplate("Command: {{ .Cmd.Name }}"))
+	if err != nil {
+		t.Fatalf("Should not have failed: %+q\n", err)
+	}
+	if cmd.CommandUsage != "Command: add" {
+		t.Fatalf("Should have used custom template: %q", cmd.CommandUsage)
+	}
+
+	err = cmdkit.RunErr("example", nil, nil, cmdkit.WithUsageTemplate("{{ .Title "), cmdkit.WithArgs(nil))
+	if err == nil || !strings.Contains(err.Error(), "failed to create template instance") {
+		t.Fatalf("Should have returned template parse error: %v", err)
+	}
+
+	err = cmdkit.RunErr("example", nil, nil, cmdkit.WithUsageTemplate("{{ .Missing }}"), cmdkit.WithArgs(nil))
+	if err == nil || !strings.Contains(err.Error(), "failed to generated help message") {
+		t.Fatalf("Should have returned template execution error: %v", err)
+	}
+}
+
+func TestSubCommandInheritsWriters(t *testing.T) {
+	var out, errOut bytes.Buffer
+	list := cmdkit.Cmd("list", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		ctx.Printf("listing %s", "items")
+		fmt.Fprint(ctx.Stderr(), "warning")
+		return nil
+	}))
+	items := cmdkit.Cmd("items", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}), cmdkit.SubCommands(list))
+
+	if list.Stdout != nil || list.Stderr != nil {
+		t.Fatalf("Should leave writers unset to inherit those of the parent")
+	}
+
+	err := cmdkit.RunErr("example", nil, []cmdkit.Command{items}, cmdkit.WithStdout(&out), cmdkit.WithStderr(&errOut), cmdkit.WithArgs([]string{"items", "list"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if out.String() != "listing items" {
+		t.Fatalf("Should have written to the root stdout: %q", out.String())
+	}
+	if errOut.String() != "warning" {
+		t.Fatalf("Should have written to the root stderr: %q", errOut.String())
+	}
+}
+
+func TestTimingsFlag(t *testing.T) {
+	var out bytes.Buffer
+	add := cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+
+	err := cmdkit.RunErr("example", nil, []cmdkit.Command{add}, cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"add"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("Should not have printed timings: %q", out.String())
+	}
+
+	err = cmdkit.RunErr("example", nil, []cmdkit.Command{add}, cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"--timings", "add"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), `command "add" took `) {
+		t.Fatalf("Should have printed timings: %q", out.String())
+	}
+}
+
+func TestConcurrentRun(t *testing.T) {
+	add := cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		if ctx.String("name") == "" {
+			return errors.New("missing name")
+		}
+		return nil
+	}))
+	add.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("name")))
+
+	flags := make([]cmdkit.Flag, 0, 10)
+	flags = append(flags, cmdkit.BoolFlag(cmdkit.FlagName("verbose")))
+	cmds := make([]cmdkit.Command, 0, 10)
+	cmds = append(cmds, add)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- cmdkit.RunErr("example", flags, cmds, cmdkit.WithArgs([]string{"--verbose", "add", fmt.Sprintf("--name=wallet-%d", i)}))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Should have successfully ran command: %v", err)
+		}
+	}
+}
+
+func TestCommandHiddenAlias(t *testing.T) {
+	var executed int
+	deploy := cmdkit.Cmd("deploy", cmdkit.HiddenAlias("ship", "release"), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		executed++
+		return nil
+	}))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"ship"}))
+	if err != nil {
+		t.Fatalf("Should have ran command through hidden alias: %v", err)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(
+		cmdkit.Cmd("app", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			return nil
+		}), cmdkit.SubCommands(deploy)),
+	), cmdkit.WithArgs([]string{"app", "release"}))
+	if err != nil {
+		t.Fatalf("Should have ran sub command through hidden alias: %v", err)
+	}
+	if executed != 2 {
+		t.Fatalf("Should have executed command for every run: %d", executed)
+	}
+
+	var out bytes.Buffer
+	cmdkit.Run("example", nil, cmdkit.Commands(deploy), cmdkit.WithNoExit(), cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"--help"}))
+	if !strings.Contains(out.String(), "deploy") {
+		t.Fatalf("Should have listed command in help: %q", out.String())
+	}
+	if strings.Contains(out.String(), "ship") || strings.Contains(out.String(), "release") {
+		t.Fatalf("Should not have listed hidden aliases in help: %q", out.String())
+	}
+}
+
+func TestFlagValidateDefault(t *testing.T) {
+	port := cmdkit.IntFlag(cmdkit.FlagName("port"))
+	port.Default = "eighty"
+	if err := port.ValidateDefault(); err == nil || err.Error() != `flag "port": "eighty" is not a valid int` {
+		t.Fatalf("Should have failed to parse string default: %v", err)
+	}
+
+	port.Default = "8080"
+	if err := port.ValidateDefault(); err != nil {
+		t.Fatalf("Should have parsed string default: %v", err)
+	}
+
+	port.Default = int64(8080)
+	if err := port.ValidateDefault(); err == nil || err.Error() != `flag "port": default 8080 is not a valid int` {
+		t.Fatalf("Should have rejected default of wrong type: %v", err)
+	}
+
+	count := cmdkit.Flag{Name: "n", Type: cmdkit.Int, Default: "abc"}
+	if err := count.ValidateDefault(); err == nil || err.Error() != `flag "n": default abc is not a valid int` {
+		t.Fatalf("Should have rejected string default of flag without parser: %v", err)
+	}
+
+	add := cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+	add.Flags = cmdkit.Flags(port)
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(add), cmdkit.WithArgs([]string{"add"}))
+	if err == nil || err.Error() != `command "add": flag "port": default 8080 is not a valid int` {
+		t.Fatalf("Should have failed to run with invalid default: %v", err)
+	}
+}
+
+func TestErrorPath(t *testing.T) {
+	errFailed := errors.New("rollback failed")
+	rollback := cmdkit.Cmd("rollback", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		if !reflect.DeepEqual(ctx.CommandPath(), []string{"deploy", "staging", "rollback"}) {
+			t.Fatalf("Should have received command path: %v", ctx.CommandPath())
+		}
+		return errFailed
+	}))
+	noop := cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	})
+	deploy := cmdkit.Cmd("deploy", noop, cmdkit.SubCommands(
+		cmdkit.Cmd("staging", noop, cmdkit.SubCommands(rollback)),
+	))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"deploy", "staging", "rollback"}))
+	if err != errFailed {
+		t.Fatalf("Should have returned action error as is: %v", err)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithErrorPath(), cmdkit.WithArgs([]string{"deploy", "staging", "rollback"}))
+	if err == nil || err.Error() != "deploy > staging > rollback: rollback failed" {
+		t.Fatalf("Should have prefixed error with command path: %v", err)
+	}
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("Should have wrapped action error: %v", err)
+	}
+}
+
+func TestFlagsAfterPositional(t *testing.T) {
+	var force bool
+	var args []string
+	push := cmdkit.Cmd("push", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		force = ctx.Bool("force")
+		args = ctx.Args()
+		return nil
+	}))
+	push.Flags = cmdkit.Flags(cmdkit.BoolFlag(cmdkit.FlagName("force")))
+
+	err := cmdkit.RunErr("mycli", nil, cmdkit.Commands(push), cmdkit.WithArgs([]string{"push", "repo.git", "--force"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if !force {
+		t.Fatal("Should have set flag following positional on push command")
+	}
+	if !reflect.DeepEqual(args, []string{"repo.git"}) {
+		t.Fatalf("Should have received positional without flags: %#v", args)
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	signals := make(chan os.Signal, 1)
+	reloaded := make(chan struct{}, 1)
+	var finished bool
+	serve := cmdkit.Cmd("serve", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		signals <- syscall.SIGHUP
+		select {
+		case <-reloaded:
+		case <-time.After(time.Second):
+			return errors.New("reload handler was not called")
+		}
+		finished = true
+		return nil
+	}))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(serve), cmdkit.WithReloadHandler(func(ctx cmdkit.Context) error {
+		reloaded <- struct{}{}
+		return nil
+	}), cmdkit.WithSignals(signals), cmdkit.WithArgs([]string{"serve"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if !finished {
+		t.Fatal("Should have continued command after reload")
+	}
+}
+
+func TestStringSliceUnique(t *testing.T) {
+	var tags []string
+	tag := cmdkit.Cmd("tag", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		tags = ctx.StringSliceUnique("labels")
+		return nil
+	}))
+	tag.Flags = cmdkit.Flags(cmdkit.StringListFlag(cmdkit.FlagName("labels")))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(tag), cmdkit.WithArgs([]string{"tag", "--labels=web,api,web,db,api"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if !reflect.DeepEqual(tags, []string{"web", "api", "db"}) {
+		t.Fatalf("Should have removed duplicates in order: %#v", tags)
+	}
+}
+
+func TestExactlyOneOf(t *testing.T) {
+	export := cmdkit.Cmd("export", cmdkit.ExactlyOneOf("file", "stdout"), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+	export.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("file")),
+		cmdkit.BoolFlag(cmdkit.FlagName("stdout")),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(export), cmdkit.WithArgs([]string{"export"}))
+	if err == nil || err.Error() != `command "export": exactly one of flags --file, --stdout must be provided` {
+		t.Fatalf("Should have failed without any flag of group: %v", err)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(export), cmdkit.WithArgs([]string{"export", "--stdout"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command with one flag of group: %v", err)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(export), cmdkit.WithArgs([]string{"export", "--stdout", "--file=out.txt"}))
+	if err == nil || err.Error() != `command "export": only one of flags --file, --stdout can be provided, got --file, --stdout` {
+		t.Fatalf("Should have failed with two flags of group: %v", err)
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	var out bytes.Buffer
+	terminal := true
+	status := cmdkit.Cmd("status", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		terminal = ctx.IsTerminal()
+		return nil
+	}))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(status), cmdkit.WithStdout(&out), cmdkit.WithArgs([]string{"status"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if terminal {
+		t.Fatal("Should not have reported a buffer as terminal")
+	}
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Should have opened null device: %v", err)
+	}
+	defer devNull.Close()
+
+	terminal = true
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(status), cmdkit.WithStdout(devNull), cmdkit.WithArgs([]string{"status"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if terminal {
+		t.Fatal("Should not have reported the null device as terminal")
+	}
+}
+
+func TestUnknownFlags(t *testing.T) {
+	var unknown []string
+	add := cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		unknown = ctx.UnknownFlags()
+		return nil
+	}))
+	add.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("name")))
+
+	err := cmdkit.RunErr("example", cmdkit.Flags(
+		cmdkit.BoolFlag(cmdkit.FlagName("verbose")),
+	), cmdkit.Commands(add), cmdkit.WithArgs([]string{"add", "--name=wallet", "--bogus", "--verbose", "--timings"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if !reflect.DeepEqual(unknown, []string{"bogus"}) {
+		t.Fatalf("Should have listed undeclared flag as unknown: %#v", unknown)
+	}
+}
+
+func TestListDelimiter(t *testing.T) {
+	paths := cmdkit.StringListFlag(cmdkit.FlagName("path"), cmdkit.ListDelimiter(':'))
+	value, err := paths.Parse("/usr/bin:/bin:/usr/local/bin")
+	if err != nil {
+		t.Fatalf("Should have successfully parsed list: %v", err)
+	}
+	if !reflect.DeepEqual(value, []string{"/usr/bin", "/bin", "/usr/local/bin"}) {
+		t.Fatalf("Should have split list on delimiter: %#v", value)
+	}
+
+	value, err = paths.Parse("a,b")
+	if err != nil {
+		t.Fatalf("Should have successfully parsed list: %v", err)
+	}
+	if !reflect.DeepEqual(value, []string{"a,b"}) {
+		t.Fatalf("Should not have split list on comma: %#v", value)
+	}
+}
+
+func TestBoolSet(t *testing.T) {
+	var value, set bool
+	build := cmdkit.Cmd("build", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		value, set = ctx.BoolSet("cache")
+		return nil
+	}))
+	build.Flags = cmdkit.Flags(cmdkit.BoolFlag(cmdkit.FlagName("cache")))
+
+	for _, tc := range []struct {
+		args  []string
+		value bool
+		set   bool
+	}{
+		{args: []string{"build"}, value: false, set: false},
+		{args: []string{"build", "--cache=false"}, value: false, set: true},
+		{args: []string{"build", "--cache"}, value: true, set: true},
+	} {
+		err := cmdkit.RunErr("example", nil, cmdkit.Commands(build), cmdkit.WithArgs(tc.args))
+		if err != nil {
+			t.Fatalf("Should have successfully ran command: %v", err)
+		}
+		if value != tc.value || set != tc.set {
+			t.Fatalf("Should have received (%t, %t) for %v: (%t, %t)", tc.value, tc.set, tc.args, value, set)
+		}
+	}
+}
+
+func TestMergeFlags(t *testing.T) {
+	defaults := cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("region"), cmdkit.Default("us-east-1")),
+		cmdkit.IntFlag(cmdkit.FlagName("replicas"), cmdkit.Default(1)),
+		cmdkit.BoolFlag(cmdkit.FlagName("verbose")),
+	)
+	profile := cmdkit.Flags(
+		cmdkit.IntFlag(cmdkit.FlagName("replicas"), cmdkit.Default(3)),
+		cmdkit.StringFlag(cmdkit.FlagName("profile"), cmdkit.Default("prod")),
+		cmdkit.StringFlag(cmdkit.FlagName("region"), cmdkit.Default("eu-west-1")),
+	)
+
+	merged := cmdkit.MergeFlags(defaults, profile)
+
+	var names []string
+	for _, flag := range merged {
+		names = append(names, flag.FlagName())
+	}
+	if !reflect.DeepEqual(names, []string{"region", "replicas", "verbose", "profile"}) {
+		t.Fatalf("Should have kept order of first appearance: %v", names)
+	}
+	if merged[0].DefaultValue() != "eu-west-1" {
+		t.Fatalf("Should have overridden region by later set: %v", merged[0].DefaultValue())
+	}
+	if merged[1].DefaultValue() != 3 {
+		t.Fatalf("Should have overridden replicas by later set: %v", merged[1].DefaultValue())
+	}
+}
+
+func TestTimeoutError(t *testing.T) {
+	wait := cmdkit.Cmd("wait", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		<-ctx.Ctx().Done()
+		return ctx.Ctx().Err()
+	}))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(wait), cmdkit.WithArgs([]string{"--timeout=10ms", "wait"}))
+	if err == nil || err.Error() != `command "wait" timed out after 10ms: context deadline exceeded` {
+		t.Fatalf("Should have returned friendly timeout error: %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Should have wrapped the deadline error: %v", err)
+	}
+}
+
+func TestFlagBindTo(t *testing.T) {
+	type region string
+	var config struct {
+		Name     string
+		Replicas int
+		Region   region
+		Verbose  bool
+	}
+
+	deploy := cmdkit.Cmd("deploy", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+	deploy.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("name"), cmdkit.BindTo(&config.Name)),
+		cmdkit.IntFlag(cmdkit.FlagName("replicas"), cmdkit.Default(2), cmdkit.BindTo(&config.Replicas)),
+		cmdkit.StringFlag(cmdkit.FlagName("region"), cmdkit.BindTo(&config.Region)),
+	)
+
+	err := cmdkit.RunErr("example", cmdkit.Flags(
+		cmdkit.BoolFlag(cmdkit.FlagName("verbose"), cmdkit.BindTo(&config.Verbose)),
+	), cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"--verbose", "deploy", "--name=api", "--region=eu"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if config.Name != "api" || config.Replicas != 2 || config.Region != "eu" || !config.Verbose {
+		t.Fatalf("Should have populated bound fields: %+v", config)
+	}
+
+	var count string
+	deploy.Flags = cmdkit.Flags(cmdkit.IntFlag(cmdkit.FlagName("replicas"), cmdkit.BindTo(&count)))
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"deploy", "--replicas=3"}))
+	if err == nil || err.Error() != `flag "replicas": can not bind int value to string` {
+		t.Fatalf("Should have failed to bind to field of other type: %v", err)
+	}
+}
+
+func TestNamespaceCommandWithoutAction(t *testing.T) {
+	var out bytes.Buffer
+	var added bool
+	remote := cmdkit.Cmd("remote", cmdkit.SubCommands(
+		cmdkit.Cmd("add", cmdkit.ShortDesc("Adds a remote"), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			added = true
+			return nil
+		})),
+	))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(remote), cmdkit.WithArgs([]string{"remote", "add"}))
+	if err != nil {
+		t.Fatalf("Should have ran sub command of namespace: %v", err)
+	}
+	if !added {
+		t.Fatal("Should have executed sub command")
+	}
+
+	err = cmdkit.Run("example", nil, cmdkit.Commands(remote), cmdkit.WithNoExit(), cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"remote"}))
+	if err != cmdkit.ErrHelp {
+		t.Fatalf("Should have printed sub commands and returned ErrHelp: %v", err)
+	}
+	if !strings.Contains(out.String(), "Adds a remote") {
+		t.Fatalf("Should have listed sub commands: %q", out.String())
+	}
+
+	exited := false
+	err = cmdkit.Run("example", nil, cmdkit.Commands(remote), cmdkit.WithExit(func(int) { exited = true }), cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"remote"}))
+	if err != nil || exited {
+		t.Fatalf("Should have treated listing sub commands as success: %v exited=%t", err, exited)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(remote), cmdkit.WithArgs([]string{"remote"}))
+	if err != cmdkit.ErrHelp {
+		t.Fatalf("Should have returned ErrHelp in silent mode: %v", err)
+	}
+}
+
+func TestContextWithValue(t *testing.T) {
+	type tenantKey struct{}
+	var tenant, region interface{}
+	status := cmdkit.Cmd("status", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		tenant = ctx.Ctx().Value(tenantKey{})
+		region, _ = ctx.Get("region")
+		return nil
+	}))
+
+	cmds := cmdkit.Commands(
+		cmdkit.Cmd("cloud", cmdkit.Before(func(ctx cmdkit.Context) (cmdkit.Context, error) {
+			return ctx.WithValue(tenantKey{}, "acme").WithValue("region", "eu-west-1"), nil
+		}), cmdkit.SubCommands(
+			cmdkit.Cmd("cluster", cmdkit.SubCommands(
+				cmdkit.Cmd("node", cmdkit.SubCommands(status)),
+			)),
+		)),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmds, cmdkit.WithArgs([]string{"cloud", "cluster", "node", "status"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if tenant != "acme" {
+		t.Fatalf("Should have received value through context: %v", tenant)
+	}
+	if region != "eu-west-1" {
+		t.Fatalf("Should have received value through Get: %v", region)
+	}
+}
+
+func TestCommandExamples(t *testing.T) {
+	var out bytes.Buffer
+	deploy := cmdkit.Cmd("deploy",
+		cmdkit.Usage("example deploy --env=qa"),
+		cmdkit.WithExample("example deploy --env=prod", "Deploys the current build to production"),
+		cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			return nil
+		}),
+	)
+
+	cmdkit.Run("example", nil, cmdkit.Commands(deploy), cmdkit.WithNoExit(), cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"deploy", "--help"}))
+	if !strings.Contains(out.String(), "example deploy --env=qa") {
+		t.Fatalf("Should have kept usages in help: %q", out.String())
+	}
+	if !strings.Contains(out.String(), "example deploy --env=prod\n\t    Deploys the current build to production") {
+		t.Fatalf("Should have shown description below example: %q", out.String())
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var dryRun bool
+	apply := cmdkit.Cmd("apply", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		dryRun = ctx.DryRun()
+		return nil
+	}))
+	cmds := cmdkit.Commands(cmdkit.Cmd("infra", cmdkit.SubCommands(apply)))
+
+	for _, tc := range []struct {
+		args   []string
+		dryRun bool
+	}{
+		{args: []string{"infra", "apply"}, dryRun: false},
+		{args: []string{"--dry-run", "infra", "apply"}, dryRun: true},
+		{args: []string{"infra", "--dry-run", "apply"}, dryRun: true},
+		{args: []string{"infra", "apply", "--dry-run"}, dryRun: true},
+	} {
+		err := cmdkit.RunErr("example", nil, cmds, cmdkit.WithArgs(tc.args))
+		if err != nil {
+			t.Fatalf("Should have successfully ran command: %v", err)
+		}
+		if dryRun != tc.dryRun {
+			t.Fatalf("Should have received dry run %t for %v", tc.dryRun, tc.args)
+		}
+	}
+}
+
+func TestEnvVarFlag(t *testing.T) {
+	var env []string
+	run := cmdkit.Cmd("exec", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		value, _ := ctx.Get("env")
+		env = value.([]string)
+		return nil
+	}))
+	run.Flags = cmdkit.Flags(cmdkit.EnvVarFlag(cmdkit.FlagName("env")))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(run), cmdkit.WithArgs([]string{"exec", "--env=HOME=/root", "--env=OPTS=a=b,c", "--env=EMPTY="}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if !reflect.DeepEqual(env, []string{"HOME=/root", "OPTS=a=b,c", "EMPTY="}) {
+		t.Fatalf("Should have accumulated variables in order: %#v", env)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(run), cmdkit.WithArgs([]string{"exec", "--env==value"}))
+	if err == nil || err.Error() != `flag "env": "=value" is not a valid KEY=VALUE pair` {
+		t.Fatalf("Should have rejected variable without key: %v", err)
+	}
+}
+
+func TestRepeatedFlagTakesLastValue(t *testing.T) {
+	var name string
+	add := cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		name = ctx.String("name")
+		return nil
+	}))
+	add.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("name")))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(add), cmdkit.WithArgs([]string{"add", "--name=first", "--name=last"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if name != "last" {
+		t.Fatalf("Should have used last value of repeated flag: %q", name)
+	}
+}
+
+func TestContextRaw(t *testing.T) {
+	var port, replicas, tags, region, zones string
+	serve := cmdkit.Cmd("serve", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		port = ctx.Raw("port")
+		replicas = ctx.Raw("replicas")
+		tags = ctx.Raw("tags")
+		region = ctx.Raw("region")
+		zones = ctx.Raw("zones")
+		return nil
+	}))
+	serve.Flags = cmdkit.Flags(
+		cmdkit.IntFlag(cmdkit.FlagName("port")),
+		cmdkit.IntFlag(cmdkit.FlagName("replicas"), cmdkit.Default(3)),
+		cmdkit.StringListFlag(cmdkit.FlagName("tags")),
+		cmdkit.StringListFlag(cmdkit.FlagName("zones"), cmdkit.Default([]string{"a", "b"})),
+	)
+
+	err := cmdkit.RunErr("example", cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("region")),
+	), cmdkit.Commands(serve), cmdkit.WithArgs([]string{"--region=eu", "serve", "--port=0x1F90", "--tags=a,b"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if port != "0x1F90" {
+		t.Fatalf("Should have returned raw string of numeric flag: %q", port)
+	}
+	if replicas != "3" {
+		t.Fatalf("Should have returned stringified default: %q", replicas)
+	}
+	if tags != "a,b" {
+		t.Fatalf("Should have returned raw string of list flag: %q", tags)
+	}
+	if zones != "a,b" {
+		t.Fatalf("Should have joined list default with commas: %q", zones)
+	}
+	if region != "eu" {
+		t.Fatalf("Should have returned raw string of parent flag: %q", region)
+	}
+}
+
+func TestCommandHelpGlobalFlags(t *testing.T) {
+	var out bytes.Buffer
+	rollback := cmdkit.Cmd("rollback", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+	rollback.Flags = cmdkit.Flags(cmdkit.IntFlag(cmdkit.FlagName("revision"), cmdkit.FlagDesc("revision to restore")))
+
+	deploy := cmdkit.Cmd("deploy", cmdkit.SubCommands(rollback))
+	deploy.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("region"), cmdkit.FlagDesc("region of deployment")))
+
+	flags := cmdkit.Flags(cmdkit.BoolFlag(cmdkit.FlagName("verbose"), cmdkit.FlagDesc("print debug logs")))
+	cmdkit.Run("example", flags, cmdkit.Commands(deploy), cmdkit.WithNoExit(), cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"deploy", "rollback", "--help"}))
+
+	help := out.String()
+	flagsAt := strings.Index(help, "⡿ Flags:")
+	globalsAt := strings.Index(help, "⡿ Global Flags:")
+	if flagsAt == -1 || globalsAt == -1 {
+		t.Fatalf("Should have rendered both flag sections: %q", help)
+	}
+
+	own, globals := help[flagsAt:globalsAt], help[globalsAt:strings.Index(help, "⡿ Examples:")]
+	if !strings.Contains(own, "--revision") || strings.Contains(own, "--region") || strings.Contains(own, "--verbose") {
+		t.Fatalf("Should have listed only own flags under Flags: %q", own)
+	}
+	if !strings.Contains(globals, "--region") || !strings.Contains(globals, "--verbose") || strings.Contains(globals, "--revision") {
+		t.Fatalf("Should have listed inherited flags under Global Flags: %q", globals)
+	}
+}
+
+func TestContextWithTimeout(t *testing.T) {
+	fetch := cmdkit.Cmd("fetch", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		short, cancel := ctx.WithTimeout(10 * time.Millisecond)
+		defer cancel()
+
+		select {
+		case <-short.Ctx().Done():
+		case <-time.After(time.Second):
+			return errors.New("derived context did not expire")
+		}
+		if short.Ctx().Err() != context.DeadlineExceeded {
+			return fmt.Errorf("derived context should have exceeded deadline: %v", short.Ctx().Err())
+		}
+		if ctx.Ctx().Err() != nil {
+			return fmt.Errorf("command context should still be valid: %v", ctx.Ctx().Err())
+		}
+		return nil
+	}))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(fetch), cmdkit.WithArgs([]string{"fetch"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+}
+
+func TestDescCutoffAtWordBoundary(t *testing.T) {
+	var out bytes.Buffer
+	desc := strings.Repeat("deploys ", 12) + "applications"
+	deploy := cmdkit.Cmd("deploy", cmdkit.Desc(desc), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+	short := cmdkit.Cmd("status", cmdkit.Desc("Shows the status"), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+
+	cmdkit.Run("example", nil, cmdkit.Commands(deploy, short), cmdkit.WithNoExit(), cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"--help"}))
+
+	expected := strings.TrimSpace(strings.Repeat("deploys ", 12)) + "..."
+	if !strings.Contains(out.String(), expected+"\n") {
+		t.Fatalf("Should have cut description at a space: %q", out.String())
+	}
+	if strings.Contains(out.String(), "appl") {
+		t.Fatalf("Should not have cut description mid word: %q", out.String())
+	}
+	if !strings.Contains(out.String(), "Shows the status\n") {
+		t.Fatalf("Should not have added ellipsis to short description: %q", out.String())
+	}
+}
+
+func TestSetFlag(t *testing.T) {
+	var values map[string]interface{}
+	install := cmdkit.Cmd("install", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		values = ctx.Nested("set")
+		return nil
+	}))
+	install.Flags = cmdkit.Flags(cmdkit.SetFlag(cmdkit.FlagName("set")))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(install), cmdkit.WithArgs([]string{
+		"install", "--set=port=8080", "--set=db.host=localhost,db.ssl=true", "--set=db.pool.ratio=0.5",
+		"--set=db.pool.limit=inf,db.pool.mode=NaN,db.pool.scale=1e3",
+	}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"port": 8080,
+		"db": map[string]interface{}{
+			"host": "localhost",
+			"ssl":  true,
+			"pool": map[string]interface{}{
+				"ratio": 0.5,
+				"limit": "inf",
+				"mode":  "NaN",
+				"scale": 1000.0,
+			},
+		},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("Should have expanded nested keys with inferred types: %#v", values)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(install), cmdkit.WithArgs([]string{"install", "--set=port=1", "--set=port.tls=true"}))
+	if err == nil || err.Error() != `flag "set": "port" is not a map` {
+		t.Fatalf("Should have failed to nest into a value: %v", err)
+	}
+}
+
+func TestListCommands(t *testing.T) {
+	cmds := cmdkit.Commands(
+		cmdkit.Cmd("add"),
+		cmdkit.Cmd("config", cmdkit.SubCommands(
+			cmdkit.Cmd("set"),
+			cmdkit.Cmd("get"),
+		)),
+	)
+
+	paths, err := cmdkit.ListCommands(cmds)
+	if err != nil {
+		t.Fatalf("Should have listed commands: %v", err)
+	}
+	if !reflect.DeepEqual(paths, []string{"add", "config", "config.get", "config.set"}) {
+		t.Fatalf("Should have listed every command path: %#v", paths)
+	}
+
+	self := cmdkit.Cmd("self")
+	self.Commands["self"] = self
+	paths, err = cmdkit.ListCommands(cmdkit.Commands(self))
+	if err == nil || err.Error() != "command cycle detected: self > self" || paths != nil {
+		t.Fatalf("Should have failed listing command containing itself: %#v %v", paths, err)
+	}
+
+	errStop := errors.New("stop")
+	var visited []string
+	err = cmdkit.Walk(cmds, func(path []string, cmd cmdkit.Command) error {
+		visited = append(visited, cmd.Name)
+		if cmd.Name == "get" {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatalf("Should have returned error of walk function: %v", err)
+	}
+	if !reflect.DeepEqual(visited, []string{"add", "config", "get"}) {
+		t.Fatalf("Should have stopped walking at error: %#v", visited)
+	}
+}
+
+func TestDefaultFromFlag(t *testing.T) {
+	var displayName, label string
+	create := cmdkit.Cmd("create", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		displayName = ctx.String("display-name")
+		label = ctx.String("label")
+		return nil
+	}))
+	create.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("label"), cmdkit.DefaultFromFlag("display-name")),
+		cmdkit.StringFlag(cmdkit.FlagName("display-name"), cmdkit.DefaultFromFlag("name")),
+		cmdkit.StringFlag(cmdkit.FlagName("name")),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(create), cmdkit.WithArgs([]string{"create", "--name=wallet"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if displayName != "wallet" || label != "wallet" {
+		t.Fatalf("Should have defaulted to value of source flag: %q, %q", displayName, label)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(create), cmdkit.WithArgs([]string{"create", "--name=wallet", "--display-name=Wallet"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if displayName != "Wallet" || label != "Wallet" {
+		t.Fatalf("Should have kept provided value: %q, %q", displayName, label)
+	}
+}
+
+func TestCommandArgsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deploy.args")
+	content := "# deployment of production\n--region=eu-west-1 --replicas=3\n--verbose\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Should have written args file: %v", err)
+	}
+
+	var region string
+	var replicas int
+	var verbose bool
+	deploy := cmdkit.Cmd("deploy", cmdkit.WithArgsFile(), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		region = ctx.String("region")
+		replicas = ctx.Int("replicas")
+		verbose = ctx.Bool("verbose")
+		return nil
+	}))
+	deploy.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("region")),
+		cmdkit.IntFlag(cmdkit.FlagName("replicas"), cmdkit.Default(1)),
+		cmdkit.BoolFlag(cmdkit.FlagName("verbose")),
+	)
+
+	cmds := cmdkit.Commands(cmdkit.Cmd("app", cmdkit.SubCommands(deploy)))
+	err := cmdkit.RunErr("example", nil, cmds, cmdkit.WithArgs([]string{"app", "deploy", "--args-file=" + path, "--replicas=5"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if region != "eu-west-1" || !verbose {
+		t.Fatalf("Should have read flags from args file: region=%q verbose=%t", region, verbose)
+	}
+	if replicas != 5 {
+		t.Fatalf("Should have preferred flag on command line: %d", replicas)
+	}
+}
+
+func TestCommandArgsFileValues(t *testing.T) {
+	dir := t.TempDir()
+	spaced := filepath.Join(dir, "spaced.args")
+	if err := os.WriteFile(spaced, []byte("--name wallet\n--verbose\n"), 0600); err != nil {
+		t.Fatalf("Should have written args file: %v", err)
+	}
+	positional := filepath.Join(dir, "positional.args")
+	if err := os.WriteFile(positional, []byte("--name=wallet origin\n"), 0600); err != nil {
+		t.Fatalf("Should have written args file: %v", err)
+	}
+
+	var name string
+	var verbose bool
+	var args []string
+	push := cmdkit.Cmd("push", cmdkit.WithArgsFile(), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		name, verbose, args = ctx.String("name"), ctx.Bool("verbose"), ctx.Args()
+		return nil
+	}))
+	push.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("name")),
+		cmdkit.BoolFlag(cmdkit.FlagName("verbose")),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(push), cmdkit.WithArgs([]string{"push", "--args-file", spaced, "upstream"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if name != "wallet" || !verbose || !reflect.DeepEqual(args, []string{"upstream"}) {
+		t.Fatalf("Should have taken space separated value from args file: name=%q verbose=%t args=%q", name, verbose, args)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(push), cmdkit.WithArgs([]string{"push", "--args-file", positional}))
+	if err == nil || !strings.Contains(err.Error(), `args file may only hold flags, got ["origin"]`) {
+		t.Fatalf("Should have rejected positional argument of args file: %v", err)
+	}
+
+	var out bytes.Buffer
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(push), cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"push", "--args-file", filepath.Join(dir, "missing.args"), "--help"}))
+	if err != cmdkit.ErrHelp {
+		t.Fatalf("Should have handled help before reading args file: %v", err)
+	}
+}
+
+func TestRenderHelp(t *testing.T) {
+	deploy := cmdkit.Cmd("deploy", cmdkit.Desc("Deploys the application"))
+	deploy.Desc = "Deploys the application to every region"
+	deploy.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("region")))
+
+	var out bytes.Buffer
+	if err := cmdkit.RenderHelp(deploy, &out); err != nil {
+		t.Fatalf("Should have rendered help: %v", err)
+	}
+	if !strings.Contains(out.String(), "Deploys the application to every region") {
+		t.Fatalf("Should have rendered mutated description: %q", out.String())
+	}
+	if !strings.Contains(out.String(), "--region") {
+		t.Fatalf("Should have rendered mutated flags: %q", out.String())
+	}
+	if strings.Contains(deploy.CommandUsage, "every region") {
+		t.Fatalf("Should not have modified usage of command: %q", deploy.CommandUsage)
+	}
+}
+
+func TestCommandCycle(t *testing.T) {
+	app := cmdkit.Cmd("app", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+	deploy := cmdkit.Cmd("deploy", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+	deploy.Commands["app"] = app
+	app.Commands["deploy"] = deploy
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(app), cmdkit.WithArgs([]string{"app"}))
+	if err == nil || err.Error() != "command cycle detected: app > deploy > app" {
+		t.Fatalf("Should have detected command cycle: %v", err)
+	}
+
+	self := cmdkit.Cmd("self")
+	self.Commands["self"] = self
+	err = cmdkit.Walk(cmdkit.Commands(self), func(path []string, cmd cmdkit.Command) error {
+		return nil
+	})
+	if err == nil || err.Error() != "command cycle detected: self > self" {
+		t.Fatalf("Should have detected command containing itself: %v", err)
+	}
+}
+
+func TestNoPositionals(t *testing.T) {
+	var listed bool
+	cmds := cmdkit.Commands(cmdkit.Cmd("remote", cmdkit.SubCommands(
+		cmdkit.Cmd("list", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			listed = true
+			return nil
+		})),
+	)))
+
+	err := cmdkit.RunErr("example", nil, cmds, cmdkit.WithNoPositionals(), cmdkit.WithArgs([]string{"remote", "list"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran sub command: %v", err)
+	}
+	if !listed {
+		t.Fatal("Should have executed sub command")
+	}
+
+	err = cmdkit.RunErr("example", nil, cmds, cmdkit.WithNoPositionals(), cmdkit.WithArgs([]string{"remote", "list", "origin"}))
+	if err == nil || err.Error() != `unexpected argument "origin"` {
+		t.Fatalf("Should have rejected stray argument: %v", err)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmds, cmdkit.WithNoPositionals(), cmdkit.WithArgs([]string{"remote", "lsit"}))
+	if err == nil || err.Error() != `unexpected argument "lsit"` {
+		t.Fatalf("Should have rejected unknown sub command: %v", err)
+	}
+}
+
+func TestPreserveCase(t *testing.T) {
+	var out bytes.Buffer
+	status := cmdkit.Cmd("Status", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+
+	cmdkit.Run("MyApp", nil, cmdkit.Commands(status), cmdkit.WithNoExit(), cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"--help"}))
+	if !strings.Contains(out.String(), "Usage: myapp ") {
+		t.Fatalf("Should have lowercased title by default: %q", out.String())
+	}
+
+	out.Reset()
+	cmdkit.Run("MyApp", nil, cmdkit.Commands(status), cmdkit.WithPreserveCase(), cmdkit.WithNoExit(), cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"--help"}))
+	if !strings.Contains(out.String(), "Usage: MyApp ") || !strings.Contains(out.String(), "Run MyApp --flags") {
+		t.Fatalf("Should have preserved case of title: %q", out.String())
+	}
+
+	err := cmdkit.RunErr("MyApp", nil, cmdkit.Commands(status), cmdkit.WithPreserveCase(), cmdkit.WithArgs([]string{"status"}))
+	if err != nil {
+		t.Fatalf("Should have matched command regardless of case in help: %v", err)
+	}
+	status.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("Region")))
+	out.Reset()
+	cmdkit.Run("MyApp", nil, cmdkit.Commands(status), cmdkit.WithNoExit(), cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"status", "--help"}))
+	if !strings.Contains(out.String(), "--region ") {
+		t.Fatalf("Should have lowercased flag in command help by default: %q", out.String())
+	}
+
+	out.Reset()
+	cmdkit.Run("MyApp", nil, cmdkit.Commands(status), cmdkit.WithPreserveCase(), cmdkit.WithNoExit(), cmdkit.WithStderr(&out), cmdkit.WithArgs([]string{"status", "--help"}))
+	if !strings.Contains(out.String(), "--Region ") || !strings.Contains(out.String(), "Command: status ") {
+		t.Fatalf("Should have preserved case of flag in command help: %q", out.String())
+	}
+}
+
+func TestElementParser(t *testing.T) {
+	parseDuration := cmdkit.ElementParser(func(s string, _ ...string) (interface{}, error) {
+		return time.ParseDuration(s)
+	})
+
+	retries := cmdkit.DurationListFlag(cmdkit.FlagName("backoff"), parseDuration)
+	value, err := retries.Parse("1s,500ms,2m")
+	if err != nil {
+		t.Fatalf("Should have parsed list items: %v", err)
+	}
+	if !reflect.DeepEqual(value, []time.Duration{time.Second, 500 * time.Millisecond, 2 * time.Minute}) {
+		t.Fatalf("Should have built duration list from element parser: %#v", value)
+	}
+
+	if _, err := retries.Parse("1s,soon"); err == nil {
+		t.Fatal("Should have failed to parse invalid item")
+	}
+
+	mismatched := cmdkit.StringListFlag(cmdkit.FlagName("backoff"), parseDuration)
+	if _, err := mismatched.Parse("1s,2s"); err == nil || err.Error() != `flag "backoff": element parser returned time.Duration items for a []string flag` {
+		t.Fatalf("Should have rejected items not of the list type: %v", err)
+	}
+
+	empty := cmdkit.StringListFlag(cmdkit.FlagName("names"), cmdkit.ElementParser(func(s string, _ ...string) (interface{}, error) {
+		return nil, nil
+	}))
+	if _, err := empty.Parse("a,b"); err == nil || err.Error() != `flag "names": element parser returned no value for "a"` {
+		t.Fatalf("Should have rejected missing item value: %v", err)
+	}
+
+	limits := cmdkit.SetFlag(cmdkit.FlagName("limits"), parseDuration)
+	value, err = limits.Parse("read=5s,write=1m")
+	if err != nil {
+		t.Fatalf("Should have parsed map values: %v", err)
+	}
+	if !reflect.DeepEqual(value, map[string]interface{}{"read": 5 * time.Second, "write": time.Minute}) {
+		t.Fatalf("Should have parsed map values with element parser: %#v", value)
+	}
+}
+
+func TestEagerValidation(t *testing.T) {
+	var ran bool
+	serve := cmdkit.Cmd("serve", cmdkit.WithEagerValidation(), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		ran = true
+		return nil
+	}))
+	serve.Flags = cmdkit.Flags(
+		cmdkit.IntFlag(cmdkit.FlagName("port")),
+		cmdkit.StringFlag(cmdkit.FlagName("mode"), cmdkit.Validate(func(value string, _ ...string) error {
+			if value != "dev" && value != "prod" {
+				return fmt.Errorf("invalid mode %q", value)
+			}
+			return nil
+		})),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(serve), cmdkit.WithArgs([]string{"serve", "--port=http", "--mode=test"}))
+	if err == nil {
+		t.Fatal("Should have failed with invalid flags")
+	}
+	if !strings.Contains(err.Error(), "http") || !strings.Contains(err.Error(), `invalid mode "test"`) {
+		t.Fatalf("Should have reported errors of both flags together: %v", err)
+	}
+	if ran {
+		t.Fatal("Should not have ran action with invalid flags")
+	}
+}
+
+func TestValueAliases(t *testing.T) {
+	var proto string
+	var protos []string
+	serve := cmdkit.Cmd("serve", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		proto = ctx.String("proto")
+		protos = ctx.StringSliceUnique("fallback")
+		return nil
+	}))
+	aliases := cmdkit.ValueAliases(map[string]string{"h2": "http2", "h1": "http1"})
+	serve.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("proto"), aliases, cmdkit.Validate(func(value string, _ ...string) error {
+			if value != "http1" && value != "http2" {
+				return fmt.Errorf("unknown protocol %q", value)
+			}
+			return nil
+		})),
+		cmdkit.StringListFlag(cmdkit.FlagName("fallback"), aliases),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(serve), cmdkit.WithArgs([]string{"serve", "--proto=h2", "--fallback=h1,grpc"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command with aliased value: %v", err)
+	}
+	if proto != "http2" {
+		t.Fatalf("Should have resolved alias to canonical value: %q", proto)
+	}
+	if !reflect.DeepEqual(protos, []string{"http1", "grpc"}) {
+		t.Fatalf("Should have resolved aliases of list items: %#v", protos)
+	}
+}
+
+func TestGraphViz(t *testing.T) {
+	cmds := cmdkit.Commands(
+		cmdkit.Cmd("add"),
+		cmdkit.Cmd("config", cmdkit.SubCommands(
+			cmdkit.Cmd("set"),
+		)),
+	)
+
+	var out bytes.Buffer
+	if err := cmdkit.GraphViz("example", cmds, &out); err != nil {
+		t.Fatalf("Should have successfully written graph: %v", err)
+	}
+
+	graph := out.String()
+	if !strings.HasPrefix(graph, `digraph "example" {`) {
+		t.Fatalf("Should have written a digraph: %s", graph)
+	}
+	for _, edge := range []string{`"example" -> "add";`, `"example" -> "config";`, `"config" -> "config.set";`} {
+		if !strings.Contains(graph, edge) {
+			t.Fatalf("Should have written edge %s: %s", edge, graph)
+		}
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	var out string
+	export := cmdkit.Cmd("export", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		out = ctx.String("out")
+		return nil
+	}))
+	export.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("name")),
+		cmdkit.StringFlag(cmdkit.FlagName("out")),
+	)
+	args := cmdkit.WithArgs([]string{"export", "--name=report", "--out={{.name}}.log"})
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(export), cmdkit.WithInterpolation(), args)
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if out != "report.log" {
+		t.Fatalf("Should have interpolated value of flag: %q", out)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(export), args)
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if out != "{{.name}}.log" {
+		t.Fatalf("Should have kept braces without interpolation: %q", out)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var names []string
+	var verbose []bool
+	greet := cmdkit.Cmd("greet", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		names = append(names, ctx.String("name"))
+		verbose = append(verbose, ctx.Bool("verbose"))
+		return nil
+	}))
+	greet.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("name"), cmdkit.Default("world")),
+		cmdkit.BoolFlag(cmdkit.FlagName("verbose")),
+	)
+	fail := cmdkit.Cmd("fail", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return errors.New("failed")
+	}))
+
+	errs := cmdkit.Batch("example", nil, cmdkit.Commands(greet, fail), [][]string{
+		{"greet", "--name=bob", "--verbose"},
+		{"fail"},
+		{"greet"},
+	})
+	if len(errs) != 3 {
+		t.Fatalf("Should have returned an error for every invocation: %#v", errs)
+	}
+	if errs[0] != nil || errs[2] != nil {
+		t.Fatalf("Should have successfully ran greet invocations: %v", errs)
+	}
+	if errs[1] == nil || errs[1].Error() != "failed" {
+		t.Fatalf("Should have returned error of failed invocation: %v", errs[1])
+	}
+	if !reflect.DeepEqual(names, []string{"bob", "world"}) || !reflect.DeepEqual(verbose, []bool{true, false}) {
+		t.Fatalf("Should have resolved flags of each invocation independently: %#v %#v", names, verbose)
+	}
+}
+
+func TestGlobalFlagsBeforeCommand(t *testing.T) {
+	var verbose bool
+	var name string
+	add := cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		verbose = ctx.Bool("verbose")
+		name = ctx.String("name")
+		return nil
+	}))
+	add.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("name")))
+	flags := cmdkit.Flags(cmdkit.BoolFlag(cmdkit.FlagName("verbose")))
+
+	err := cmdkit.RunErr("mycli", flags, cmdkit.Commands(add), cmdkit.WithArgs([]string{"--verbose", "add", "--name=x"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command with flags before it: %v", err)
+	}
+	if !verbose || name != "x" {
+		t.Fatalf("Should have resolved flags before and after command: verbose=%t name=%q", verbose, name)
+	}
+
+	err = cmdkit.RunErr("mycli", flags, cmdkit.Commands(add), cmdkit.WithArgs([]string{"--name=x", "add"}))
+	if err == nil || err.Error() != `flag "name" of command "add" must come after the command name` {
+		t.Fatalf("Should have failed with flag of command before it: %v", err)
+	}
+}
+
+func TestGlobalFlagsAfterCommand(t *testing.T) {
+	var config, region string
+	var args []string
+	push := cmdkit.Cmd("push", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		config, region, args = ctx.String("config"), ctx.String("region"), ctx.Args()
+		return nil
+	}))
+	app := cmdkit.Cmd("app", cmdkit.SubCommands(push))
+	app.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("region"), cmdkit.Default("us")))
+	flags := cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("config"), cmdkit.Default("default.yaml")))
+
+	err := cmdkit.RunErr("mycli", flags, cmdkit.Commands(app), cmdkit.WithArgs([]string{"app", "push", "--config", "a.yaml", "--region", "eu", "origin"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if config != "a.yaml" || region != "eu" || !reflect.DeepEqual(args, []string{"origin"}) {
+		t.Fatalf("Should have resolved global flags after command: config=%q region=%q args=%q", config, region, args)
+	}
+
+	err = cmdkit.RunErr("mycli", flags, cmdkit.Commands(app), cmdkit.WithArgs([]string{"app", "push"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if config != "default.yaml" || region != "us" {
+		t.Fatalf("Should have kept defaults of global flags: config=%q region=%q", config, region)
+	}
+}
+
+func TestCaseInsensitiveFlags(t *testing.T) {
+	var name, region string
+	add := cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		name = ctx.String("name")
+		region = ctx.String("Region")
+		return nil
+	}))
+	add.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("name")),
+		cmdkit.StringFlag(cmdkit.FlagName("Region")),
+	)
+	args := cmdkit.WithArgs([]string{"add", "--NAME=x", "--region=eu"})
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(add), cmdkit.WithCaseInsensitiveFlags(), args)
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if name != "x" || region != "eu" {
+		t.Fatalf("Should have matched flags regardless of case: name=%q region=%q", name, region)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(add), args)
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if name != "" || region != "" {
+		t.Fatalf("Should have matched flags exactly by default: name=%q region=%q", name, region)
+	}
+}
+
+func TestLazyHelp(t *testing.T) {
+	add := cmdkit.Cmd("add", cmdkit.Desc("Adds an item"), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+	add.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("name")))
+	if add.CommandUsage != "" || add.FlagUsage != "" {
+		t.Fatalf("Should not have rendered usage when creating command: %q", add.CommandUsage)
+	}
+
+	var errOut bytes.Buffer
+	err := cmdkit.Run("example", nil, cmdkit.Commands(add), cmdkit.WithNoExit(), cmdkit.WithStderr(&errOut), cmdkit.WithArgs([]string{"add", "--help"}))
+	if err != cmdkit.ErrHelp {
+		t.Fatalf("Should have returned help error: %v", err)
+	}
+	if !strings.Contains(errOut.String(), "Adds an item") || !strings.Contains(errOut.String(), "--name") {
+		t.Fatalf("Should have rendered usage when help was requested: %q", errOut.String())
+	}
+	if add.CommandUsage != "" {
+		t.Fatalf("Should not have stored rendered usage on command: %q", add.CommandUsage)
+	}
+}
+
+func BenchmarkCmd(b *testing.B) {
+	flags := cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("name"), cmdkit.FlagDesc("Name of the item")),
+		cmdkit.IntFlag(cmdkit.FlagName("count"), cmdkit.FlagDesc("Count of the item")),
+	)
+	for i := 0; i < b.N; i++ {
+		cmdkit.Cmd("add", cmdkit.Desc("Adds an item"), cmdkit.SubCommands(
+			cmdkit.Cmd("item", cmdkit.Desc("Adds an item")),
+		), func(cmd *cmdkit.Command) {
+			cmd.Flags = flags
+		})
+	}
+}
+
+func TestHeaderFlag(t *testing.T) {
+	var header http.Header
+	fetch := cmdkit.Cmd("fetch", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		header = ctx.Header("header")
+		return nil
+	}))
+	fetch.Flags = cmdkit.Flags(cmdkit.HeaderFlag(cmdkit.FlagName("header")))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(fetch), cmdkit.WithArgs([]string{
+		"fetch", "--header=accept:text/plain", "--header=x-trace-id=1", "--header=Accept=application/json",
+	}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+
+	expected := http.Header{
+		"Accept":     {"text/plain", "application/json"},
+		"X-Trace-Id": {"1"},
+	}
+	if !reflect.DeepEqual(header, expected) {
+		t.Fatalf("Should have accumulated headers with canonical names: %#v", header)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(fetch), cmdkit.WithArgs([]string{"fetch", "--header=accept"}))
+	if err == nil {
+		t.Fatal("Should have failed with header without value")
+	}
+}
+
+func TestTypedArgs(t *testing.T) {
+	var count int
+	var wait time.Duration
+	var countErr, waitErr, missingErr error
+	scale := cmdkit.Cmd("scale", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		count, countErr = ctx.ArgInt(0)
+		wait, waitErr = ctx.ArgDuration(1)
+		_, missingErr = ctx.ArgBool(2)
+		return nil
+	}))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(scale), cmdkit.WithArgs([]string{"scale", "3", "5s"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if countErr != nil || count != 3 {
+		t.Fatalf("Should have parsed int argument: %d %v", count, countErr)
+	}
+	if waitErr != nil || wait != 5*time.Second {
+		t.Fatalf("Should have parsed duration argument: %s %v", wait, waitErr)
+	}
+	if missingErr == nil || missingErr.Error() != "missing argument 3, got 2 arguments" {
+		t.Fatalf("Should have failed with missing argument: %v", missingErr)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(scale), cmdkit.WithArgs([]string{"scale", "three"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if countErr == nil || countErr.Error() != `argument 1: "three" is not a valid int` {
+		t.Fatalf("Should have failed with malformed int argument: %v", countErr)
+	}
+
+	var mask int64
+	var maskErr error
+	chmod := cmdkit.Cmd("chmod", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		count, countErr = ctx.ArgInt(0)
+		mask, maskErr = ctx.ArgInt64(1)
+		return nil
+	}))
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(chmod), cmdkit.WithArgs([]string{"chmod", "0x10", "0o755"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if countErr != nil || count != 16 || maskErr != nil || mask != 0755 {
+		t.Fatalf("Should have parsed int arguments with base prefixes as flags do: %d %v %d %v", count, countErr, mask, maskErr)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	var requireErr error
+	add := cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		requireErr = ctx.Require("name", "count")
+		return nil
+	}))
+	add.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("name")),
+		cmdkit.IntFlag(cmdkit.FlagName("count"), cmdkit.Default(1)),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(add), cmdkit.WithArgs([]string{"add"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if requireErr == nil || requireErr.Error() != `command "add": flags --name, --count must be provided` {
+		t.Fatalf("Should have listed every missing flag: %v", requireErr)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(add), cmdkit.WithArgs([]string{"add", "--count=2"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if requireErr == nil || requireErr.Error() != `command "add": flag --name must be provided` {
+		t.Fatalf("Should have failed with unset flag: %v", requireErr)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(add), cmdkit.WithArgs([]string{"add", "--count=2", "--name=x"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if requireErr != nil {
+		t.Fatalf("Should not have failed with all flags provided: %v", requireErr)
+	}
+}
+
+func TestUnitFlag(t *testing.T) {
+	var rate, size float64
+	serve := cmdkit.Cmd("serve", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		rate = ctx.Float64("rate")
+		size = ctx.Float64("size")
+		return nil
+	}))
+	serve.Flags = cmdkit.Flags(
+		cmdkit.UnitFlag(cmdkit.UnitRegistry{"qps": 1, "qpm": 1.0 / 60}, cmdkit.FlagName("rate")),
+		cmdkit.UnitFlag(cmdkit.ByteUnits, cmdkit.FlagName("size")),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(serve), cmdkit.WithArgs([]string{"serve", "--rate=5qps", "--size=2MiB"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if rate != 5 {
+		t.Fatalf("Should have parsed value with custom unit: %f", rate)
+	}
+	if size != 2<<20 {
+		t.Fatalf("Should have parsed value with byte unit: %f", size)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(serve), cmdkit.WithArgs([]string{"serve", "--rate=5rpm"}))
+	if err == nil || err.Error() != `flag "rate": "5rpm" is not a number with one of units qpm, qps` {
+		t.Fatalf("Should have failed with unknown unit: %v", err)
+	}
+}
+
+func TestUnsignedFlags(t *testing.T) {
+	var small uint8
+	var medium uint16
+	var large uint32
+	var huge uint64
+	limits := cmdkit.Cmd("limits", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		small, medium, large, huge = ctx.Uint8("small"), ctx.Uint16("medium"), ctx.Uint32("large"), ctx.Uint64("huge")
+		return nil
+	}))
+	limits.Flags = cmdkit.Flags(
+		cmdkit.UInt8Flag(cmdkit.FlagName("small")),
+		cmdkit.UInt16Flag(cmdkit.FlagName("medium")),
+		cmdkit.UInt32Flag(cmdkit.FlagName("large"), cmdkit.Default(uint32(7))),
+		cmdkit.UInt64Flag(cmdkit.FlagName("huge"), cmdkit.Default(uint64(9))),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(limits), cmdkit.WithArgs([]string{"limits", "--small=255", "--medium=65535"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if small != 255 || medium != 65535 || large != 7 || huge != 9 {
+		t.Fatalf("Should have resolved unsigned flags: %d %d %d %d", small, medium, large, huge)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(limits), cmdkit.WithArgs([]string{"limits", "--small=256"}))
+	if err == nil || err.Error() != `flag "small": "256" is not a valid uint8` {
+		t.Fatalf("Should have failed with value out of range: %v", err)
+	}
+
+	if flag := cmdkit.UInt64Flag(); flag.TypeString() != "uint64" {
+		t.Fatalf("Should have typed flag as uint64: %q", flag.TypeString())
+	}
+}
+
+func TestFlagCollisions(t *testing.T) {
+	var ran bool
+	add := cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		ran = true
+		return nil
+	}))
+	add.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("name"), cmdkit.FlagAlias("n")),
+		cmdkit.IntFlag(cmdkit.FlagName("n")),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(add), cmdkit.WithArgs([]string{"add", "--n=1"}))
+	if err == nil || err.Error() != `command "add": flag "n" collides with flag "name" on "n"` {
+		t.Fatalf("Should have failed with colliding flags: %v", err)
+	}
+	if ran {
+		t.Fatal("Should not have ran command with colliding flags")
+	}
+
+	flags := cmdkit.Flags(
+		cmdkit.BoolFlag(cmdkit.FlagName("verbose")),
+		cmdkit.BoolFlag(cmdkit.FlagName("quiet"), cmdkit.FlagAlias("verbose")),
+	)
+	err = cmdkit.RunErr("example", flags, cmdkit.Commands(add), cmdkit.WithArgs([]string{"add"}))
+	if err == nil || err.Error() != `flag "quiet" collides with flag "verbose" on "verbose"` {
+		t.Fatalf("Should have failed with colliding program flags: %v", err)
+	}
+}
+
+func TestListFlagTypes(t *testing.T) {
+	for expected, flag := range map[string]cmdkit.Flag{
+		"[]string":        cmdkit.StringListFlag(),
+		"[]bool":          cmdkit.BoolListFlag(),
+		"[]int":           cmdkit.IntListFlag(),
+		"[]int64":         cmdkit.Int64ListFlag(),
+		"[]uint":          cmdkit.UIntListFlag(),
+		"[]uint64":        cmdkit.UInt64ListFlag(),
+		"[]float64":       cmdkit.Float64ListFlag(),
+		"[]time.Duration": cmdkit.DurationListFlag(),
+	} {
+		if flag.TypeString() != expected {
+			t.Fatalf("Should have typed list flag as %s: %s", expected, flag.TypeString())
+		}
+		if !flag.Type.IsList() {
+			t.Fatalf("Should have reported %s flag as list", expected)
+		}
+	}
+}
+
+func TestUsageError(t *testing.T) {
+	add := cmdkit.Cmd("add", cmdkit.Desc("Adds an item to the list"), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return errors.New("failed to add")
+	}))
+	add.Flags = cmdkit.Flags(cmdkit.IntFlag(cmdkit.FlagName("count")))
+
+	var out bytes.Buffer
+	var code int
+	exit := cmdkit.WithExit(func(c int) {
+		code = c
+	})
+
+	err := cmdkit.Run("example", nil, cmdkit.Commands(add), cmdkit.WithStderr(&out), exit, cmdkit.WithArgs([]string{"add", "--count=many"}))
+	var usageErr *cmdkit.UsageError
+	if !errors.As(err, &usageErr) {
+		t.Fatalf("Should have returned usage error for invalid flag: %v", err)
+	}
+	if code != 2 {
+		t.Fatalf("Should have exited with code 2: %d", code)
+	}
+	if !strings.Contains(out.String(), "Adds an item to the list") || !strings.Contains(out.String(), `"many" is not a valid int`) {
+		t.Fatalf("Should have printed usage with error: %q", out.String())
+	}
+
+	out.Reset()
+	err = cmdkit.Run("example", nil, cmdkit.Commands(add), cmdkit.WithStderr(&out), exit, cmdkit.WithArgs([]string{"add", "--count=1"}))
+	if errors.As(err, &usageErr) {
+		t.Fatalf("Should not have returned usage error for failed action: %v", err)
+	}
+	if code != 1 {
+		t.Fatalf("Should have exited with code 1: %d", code)
+	}
+	if out.String() != "failed to add" {
+		t.Fatalf("Should have printed error without usage: %q", out.String())
+	}
+}
+
+func TestSpaceSeparatedFlagValues(t *testing.T) {
+	var name string
+	var verbose, force bool
+	var args []string
+	push := cmdkit.Cmd("push", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		name, verbose, force, args = ctx.String("name"), ctx.Bool("verbose"), ctx.Bool("force"), ctx.Args()
+		return nil
+	}))
+	push.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("name")),
+		cmdkit.BoolFlag(cmdkit.FlagName("force")),
+	)
+	flags := cmdkit.Flags(cmdkit.BoolFlag(cmdkit.FlagName("verbose")))
+
+	for _, invocation := range [][]string{
+		{"--verbose", "push", "--name", "wallet", "--force", "origin"},
+		{"--verbose", "push", "--name=wallet", "--force", "origin"},
+	} {
+		name, verbose, force, args = "", false, false, nil
+		err := cmdkit.RunErr("example", flags, cmdkit.Commands(push), cmdkit.WithArgs(invocation))
+		if err != nil {
+			t.Fatalf("Should have successfully ran %q: %v", invocation, err)
+		}
+		if name != "wallet" || !verbose || !force || !reflect.DeepEqual(args, []string{"origin"}) {
+			t.Fatalf("Should have parsed %q identically: name=%q verbose=%t force=%t args=%q", invocation, name, verbose, force, args)
+		}
+	}
+}
+
+func TestSpaceSeparatedEmptyAndNoValueFlags(t *testing.T) {
+	var msg, mode string
+	var args []string
+	push := cmdkit.Cmd("push", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		msg, mode, args = ctx.String("msg"), ctx.String("mode"), ctx.Args()
+		return nil
+	}))
+	push.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("msg"), cmdkit.Default("unset")),
+		cmdkit.StringFlag(cmdkit.FlagName("mode"), cmdkit.FlagNoValue()),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(push), cmdkit.WithArgs([]string{"push", "--msg", "", "--mode", "origin"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if msg != "" {
+		t.Fatalf("Should have kept the empty value of msg: %q", msg)
+	}
+	if mode != "true" || !reflect.DeepEqual(args, []string{"origin"}) {
+		t.Fatalf("Should not have taken the following argument for mode: mode=%q args=%q", mode, args)
+	}
+}
+
+func TestCommandSubstitutionSkipsEnvAndConfig(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake commands are shell scripts")
+	}
+
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	script := filepath.Join(dir, "script")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ntouch "+marker+"\necho s3cr3t\n"), 0755); err != nil {
+		t.Fatalf("Should have written fake command: %v", err)
+	}
+	config := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(config, []byte("login:\n  token: \"$("+script+")\"\n"), 0644); err != nil {
+		t.Fatalf("Should have written config: %v", err)
+	}
+
+	var token, user string
+	login := cmdkit.Cmd("login", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		token, user = ctx.String("token"), ctx.String("user")
+		return nil
+	}))
+	login.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("token")),
+		cmdkit.StringFlag(cmdkit.FlagName("user"), cmdkit.Env("CMDKIT_SUBSTITUTION_USER")),
+	)
+	t.Setenv("CMDKIT_SUBSTITUTION_USER", "$("+script+")")
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(login), cmdkit.WithCommandSubstitution(), cmdkit.WithConfigFiles(config), cmdkit.WithArgs([]string{"login"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if token != "$("+script+")" || user != "$("+script+")" {
+		t.Fatalf("Should have kept config and env values as is: %q %q", token, user)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatal("Should not have ran command of config or env value")
+	}
+}
+
+func TestCommandSubstitutionSkipsArgsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "login.args")
+	if err := os.WriteFile(path, []byte(`--token="$(echo pwned)"`+"\n"), 0600); err != nil {
+		t.Fatalf("Should have written args file: %v", err)
+	}
+
+	var token, source string
+	login := cmdkit.Cmd("login", cmdkit.WithArgsFile(), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		token = ctx.String("token")
+		return nil
+	}))
+	login.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("token")))
+
+	observer := func(name string, value interface{}, from string) {
+		if name == "token" {
+			source = from
+		}
+	}
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(login), cmdkit.WithCommandSubstitution(), cmdkit.WithFlagObserver(observer), cmdkit.WithArgs([]string{"login", "--args-file=" + path}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if token != "$(echo pwned)" {
+		t.Fatalf("Should have kept args file value as is: %q", token)
+	}
+	if source != cmdkit.SourceFile {
+		t.Fatalf("Should have reported args file as source: %q", source)
+	}
+}
+
+func TestCommandSubstitution(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake commands are shell scripts")
+	}
+
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	failing := filepath.Join(dir, "failing")
+	if err := os.WriteFile(secret, []byte("#!/bin/sh\necho \"  s3cr3t\"\n"), 0755); err != nil {
+		t.Fatalf("Should have written fake command: %v", err)
+	}
+	if err := os.WriteFile(failing, []byte("#!/bin/sh\necho denied >&2\nexit 3\n"), 0755); err != nil {
+		t.Fatalf("Should have written fake command: %v", err)
+	}
+
+	var token string
+	login := cmdkit.Cmd("login", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		token = ctx.String("token")
+		return nil
+	}))
+	login.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("token")))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(login), cmdkit.WithCommandSubstitution(), cmdkit.WithArgs([]string{"login", "--token=$(" + secret + ")"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if token != "s3cr3t" {
+		t.Fatalf("Should have used trimmed output of command as value: %q", token)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(login), cmdkit.WithCommandSubstitution(), cmdkit.WithArgs([]string{"login", "--token=$(" + failing + ")"}))
+	if err == nil || !strings.Contains(err.Error(), "exit status 3: denied") {
+		t.Fatalf("Should have failed with failing command: %v", err)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(login), cmdkit.WithArgs([]string{"login", "--token=$(" + secret + ")"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if token != "$("+secret+")" {
+		t.Fatalf("Should have kept value without command substitution: %q", token)
+	}
+}
+
+func TestRunKeepsArgsWithSpaces(t *testing.T) {
+	var msg string
+	echo := cmdkit.Cmd("echo", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		msg = ctx.String("msg")
+		return nil
+	}))
+	echo.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("msg")))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(echo), cmdkit.WithArgs([]string{"echo", `--msg=it's "hello world"`}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if msg != `it's "hello world"` {
+		t.Fatalf("Should have kept argument with spaces and quotes whole: %q", msg)
+	}
+}
+
+func TestCommandRequires(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a unix shell in PATH")
+	}
+
+	var ran bool
+	build := cmdkit.Cmd("build", cmdkit.WithRequires("sh"), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		ran = true
+		return nil
+	}))
+	if err := cmdkit.RunErr("example", nil, cmdkit.Commands(build), cmdkit.WithArgs([]string{"build"})); err != nil || !ran {
+		t.Fatalf("Should have ran command with present binary: %v", err)
+	}
+
+	ran = false
+	deploy := cmdkit.Cmd("deploy", cmdkit.WithRequires("sh", "cmdkit-missing-binary"), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		ran = true
+		return nil
+	}))
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"deploy"}))
+	if err == nil || !strings.Contains(err.Error(), `required binary "cmdkit-missing-binary" not found in PATH`) {
+		t.Fatalf("Should have failed with absent binary: %v", err)
+	}
+	if ran {
+		t.Fatal("Should not have ran action with absent binary")
+	}
+}
+
+func TestRunWithError(t *testing.T) {
+	var stderr bytes.Buffer
+	add := cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error { return nil }))
+
+	err := cmdkit.RunWithError("example", nil, cmdkit.Commands(add), cmdkit.WithStderr(&stderr), cmdkit.WithArgs([]string{"remove"}))
+	var usageErr *cmdkit.UsageError
+	if !errors.As(err, &usageErr) {
+		t.Fatalf("Should have returned usage error for unknown command: %v", err)
+	}
+	if stderr.Len() != 0 {
+		t.Fatalf("Should not have printed returned error: %q", stderr.String())
+	}
+
+	broken := cmdkit.Cmd("broken", cmdkit.UsageTemplate("{{.Cmd.Missing}}"))
+	err = cmdkit.RunWithError("example", nil, cmdkit.Commands(add, broken), cmdkit.WithArgs([]string{"add"}))
+	var execErr template.ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("Should have returned template error of command: %v", err)
+	}
+
+	err = cmdkit.RunWithError("example", nil, cmdkit.Commands(add), cmdkit.WithStderr(&stderr), cmdkit.WithArgs([]string{"add", "--help"}))
+	if !errors.Is(err, cmdkit.ErrHelp) || stderr.Len() == 0 {
+		t.Fatalf("Should have printed help and returned ErrHelp: %v", err)
+	}
+
+	stderr.Reset()
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(add), cmdkit.WithStderr(&stderr), cmdkit.WithArgs([]string{"add", "--help"}))
+	if !errors.Is(err, cmdkit.ErrHelp) || stderr.Len() != 0 {
+		t.Fatalf("Should have returned ErrHelp without printing help: %v %q", err, stderr.String())
+	}
+}
+
+func TestRunArgs(t *testing.T) {
+	var msg string
+	echo := cmdkit.Cmd("echo", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		msg = ctx.String("msg")
+		return nil
+	}))
+	echo.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("msg")))
+
+	err := cmdkit.RunArgs("example", []string{"echo", `--msg='quoted' "words"`}, nil, cmdkit.Commands(echo))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if msg != `'quoted' "words"` {
+		t.Fatalf("Should have kept argument with quotes whole: %q", msg)
+	}
+
+	err = cmdkit.RunArgs("example", []string{"echo", "--msg", "second line"}, nil, cmdkit.Commands(echo))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if msg != "second line" {
+		t.Fatalf("Should have kept argument with spaces whole: %q", msg)
+	}
+
+	err = cmdkit.RunArgs("example", []string{"missing"}, nil, cmdkit.Commands(echo))
+	var usageErr *cmdkit.UsageError
+	if !errors.As(err, &usageErr) {
+		t.Fatalf("Should have returned error of unknown command: %v", err)
+	}
+	err = cmdkit.RunArgs("example", []string{"echo", "--msg=[unterminated"}, nil, cmdkit.Commands(echo))
+	if !errors.As(err, &usageErr) || !strings.Contains(err.Error(), "unterminated list") {
+		t.Fatalf("Should have returned usage error of unterminated list: %v", err)
+	}
+}
+
+func TestContextJoined(t *testing.T) {
+	var paths, ports, unset string
+	serve := cmdkit.Cmd("serve", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		paths, ports, unset = ctx.Joined("paths", ":"), ctx.Joined("ports", ","), ctx.Joined("hosts", ":")
+		return nil
+	}))
+	serve.Flags = cmdkit.Flags(
+		cmdkit.StringListFlag(cmdkit.FlagName("paths")),
+		cmdkit.IntListFlag(cmdkit.FlagName("ports")),
+		cmdkit.StringListFlag(cmdkit.FlagName("hosts")),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(serve), cmdkit.WithArgs([]string{"serve", "--paths=[a,b]", "--ports=[80,443]"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if paths != "a:b" || ports != "80,443" || unset != "" {
+		t.Fatalf("Should have joined list values: %q %q %q", paths, ports, unset)
+	}
+}
+
+func TestRequiredFlags(t *testing.T) {
+	var ran bool
+	deploy := cmdkit.Cmd("deploy", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		ran = true
+		return nil
+	}))
+	deploy.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("region"), cmdkit.FlagRequired()),
+		cmdkit.StringFlag(cmdkit.FlagName("token"), cmdkit.Env("DEPLOY_REQUIRED_TOKEN"), cmdkit.FlagRequired()),
+		cmdkit.StringFlag(cmdkit.FlagName("mode"), cmdkit.Default("fast"), cmdkit.FlagRequired()),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"deploy"}))
+	var usageErr *cmdkit.UsageError
+	if !errors.As(err, &usageErr) || !strings.Contains(err.Error(), `command "deploy": required flags --region, --token were not provided`) {
+		t.Fatalf("Should have failed listing every missing required flag: %v", err)
+	}
+	if ran {
+		t.Fatal("Should not have ran action with missing required flags")
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"deploy", "--help"}))
+	if err != cmdkit.ErrHelp {
+		t.Fatalf("Should have shown help without required flags: %v", err)
+	}
+
+	t.Setenv("DEPLOY_REQUIRED_TOKEN", "s3cr3t")
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"deploy", "--region=eu"}))
+	if err != nil || !ran {
+		t.Fatalf("Should have ran command with required flags resolved: %v", err)
+	}
+}
+
+func TestQuietFlag(t *testing.T) {
+	var quiet bool
+	report := cmdkit.Cmd("report", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		quiet = ctx.Quiet()
+		ctx.Println("progress")
+		ctx.Printf("done %d\n", 1)
+		fmt.Fprintln(ctx.Stderr(), "warning")
+		return nil
+	}))
+
+	for _, args := range [][]string{{"report", "--quiet"}, {"-q", "report"}, {"report"}} {
+		var stdout, stderr bytes.Buffer
+		err := cmdkit.RunErr("example", nil, cmdkit.Commands(report), cmdkit.WithStdout(&stdout), cmdkit.WithStderr(&stderr), cmdkit.WithArgs(args))
+		if err != nil {
+			t.Fatalf("Should have successfully ran command: %v", err)
+		}
+		if stderr.String() != "warning\n" {
+			t.Fatalf("Should have written to stderr with %v: %q", args, stderr.String())
+		}
+
+		expected := "progress\ndone 1\n"
+		if len(args) == 2 {
+			expected = ""
+		}
+		if stdout.String() != expected || quiet != (len(args) == 2) {
+			t.Fatalf("Should have written %q with %v: %q", expected, args, stdout.String())
+		}
+	}
+}
+
+func TestMutuallyExclusive(t *testing.T) {
+	output := func(ops ...cmdkit.CommandFunc) cmdkit.Command {
+		cmd := cmdkit.Cmd("show", append(ops, cmdkit.WithAction(func(ctx cmdkit.Context) error {
+			return nil
+		}))...)
+		cmd.Flags = cmdkit.Flags(
+			cmdkit.BoolFlag(cmdkit.FlagName("json")),
+			cmdkit.BoolFlag(cmdkit.FlagName("yaml")),
+			cmdkit.BoolFlag(cmdkit.FlagName("toml")),
+		)
+		return cmd
+	}
+
+	show := output(cmdkit.MutuallyExclusive("json", "yaml", "toml"))
+	for _, args := range [][]string{{"show"}, {"show", "--yaml"}} {
+		if err := cmdkit.RunErr("example", nil, cmdkit.Commands(show), cmdkit.WithArgs(args)); err != nil {
+			t.Fatalf("Should have successfully ran command with %v: %v", args, err)
+		}
+	}
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(show), cmdkit.WithArgs([]string{"show", "--json", "--yaml"}))
+	if err == nil || err.Error() != `command "show": flags --json and --yaml are mutually exclusive` {
+		t.Fatalf("Should have failed with two exclusive flags: %v", err)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(show), cmdkit.WithArgs([]string{"show", "--json", "--yaml", "--toml"}))
+	if err == nil || err.Error() != `command "show": flags --json, --yaml and --toml are mutually exclusive` {
+		t.Fatalf("Should have failed with three exclusive flags: %v", err)
+	}
+
+	required := output(cmdkit.RequireOneOf("json", "yaml", "toml"))
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(required), cmdkit.WithArgs([]string{"show"}))
+	if err == nil || err.Error() != `command "show": exactly one of flags --json, --yaml, --toml must be provided` {
+		t.Fatalf("Should have failed without any required flag: %v", err)
+	}
+	if err := cmdkit.RunErr("example", nil, cmdkit.Commands(required), cmdkit.WithArgs([]string{"show", "--toml"})); err != nil {
+		t.Fatalf("Should have successfully ran command with one required flag: %v", err)
+	}
+}
+
+func TestHelpSpellings(t *testing.T) {
+	var ran bool
+	add := cmdkit.Cmd("add", cmdkit.Desc("Add a remote"), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		ran = true
+		return nil
+	}))
+	remote := cmdkit.Cmd("remote", cmdkit.Desc("Manage remotes"), cmdkit.SubCommands(add))
+	list := cmdkit.Cmd("list", cmdkit.Desc("List items"), cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		ran = true
+		return nil
+	}))
+
+	help := func(args ...string) string {
+		var stderr bytes.Buffer
+		err := cmdkit.RunWithError("example", nil, cmdkit.Commands(list, remote), cmdkit.WithStderr(&stderr), cmdkit.WithArgs(args))
+		if err != cmdkit.ErrHelp {
+			t.Fatalf("Should have printed help for %v: %v", args, err)
+		}
+		return stderr.String()
+	}
+
+	for _, spellings := range [][][]string{
+		{{"list", "-h"}, {"list", "help"}, {"help", "list"}},
+		{{"remote", "add", "--help"}, {"remote", "add", "help"}, {"help", "remote", "add"}},
+		{{"--help"}, {"help"}},
+	} {
+		expected := help(spellings[0]...)
+		for _, args := range spellings[1:] {
+			if out := help(args...); out != expected {
+				t.Fatalf("Should have printed same help for %v as %v:\n%s\n%s", args, spellings[0], out, expected)
+			}
+		}
+	}
+	if !strings.Contains(help("help", "remote", "add"), "Add a remote") {
+		t.Fatal("Should have printed help of named command")
+	}
+	if ran {
+		t.Fatal("Should not have ran action when help was requested")
+	}
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(list), cmdkit.WithArgs([]string{"help", "missing"}))
+	if err == nil || !strings.Contains(err.Error(), `command not found "missing"`) {
+		t.Fatalf("Should have failed with unknown command: %v", err)
+	}
+}
+
+func TestInterruptCancelsContext(t *testing.T) {
+	signals := make(chan os.Signal, 1)
+	var cancelled bool
+	serve := cmdkit.Cmd("serve", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		signals <- os.Interrupt
+		select {
+		case <-ctx.Ctx().Done():
+			cancelled = true
+			return ctx.Ctx().Err()
+		case <-time.After(time.Second):
+			return errors.New("context was not cancelled by interrupt")
+		}
+	}))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(serve), cmdkit.WithSignals(signals), cmdkit.WithArgs([]string{"serve"}))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Should have returned error of cancelled command: %v", err)
+	}
+	if !cancelled {
+		t.Fatal("Should have cancelled context of command on interrupt")
+	}
+}
+
+func TestQuietFlagShadowed(t *testing.T) {
+	var quiet bool
+	var query string
+	var stdout bytes.Buffer
+	search := cmdkit.Cmd("search", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		quiet, query = ctx.Quiet(), ctx.String("query")
+		ctx.Println("found")
+		return nil
+	}))
+	search.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("query"), cmdkit.FlagAlias("q")))
+	flags := cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("quiet")))
+
+	err := cmdkit.RunErr("example", flags, cmdkit.Commands(search), cmdkit.WithStdout(&stdout), cmdkit.WithArgs([]string{"--quiet=yes", "search", "-q=cmdkit"}))
+	if err != nil {
+		t.Fatalf("Should have ran command declaring flags of built-in quiet flag: %v", err)
+	}
+	if query != "cmdkit" || quiet || stdout.String() != "found\n" {
+		t.Fatalf("Should have used declared flags in place of built-in quiet flag: %q %t %q", query, quiet, stdout.String())
+	}
+}
+
+func TestDryRunFlagShadowed(t *testing.T) {
+	var dryRun bool
+	var mode string
+	apply := cmdkit.Cmd("apply", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		dryRun, mode = ctx.DryRun(), ctx.String("dry-run")
+		return nil
+	}))
+	apply.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("dry-run")))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(apply), cmdkit.WithArgs([]string{"apply", "--dry-run=server"}))
+	if err != nil {
+		t.Fatalf("Should have ran command declaring its own dry-run flag: %v", err)
+	}
+	if mode != "server" || dryRun {
+		t.Fatalf("Should have used declared flag in place of built-in dry-run flag: %q %t", mode, dryRun)
+	}
+}
+
+func TestTimingsFlagShadowed(t *testing.T) {
+	var timings []string
+	var stderr bytes.Buffer
+	bench := cmdkit.Cmd("bench", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		timings = ctx.StringSliceUnique("timings")
+		return nil
+	}))
+	bench.Flags = cmdkit.Flags(cmdkit.StringListFlag(cmdkit.FlagName("timings")))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(bench), cmdkit.WithStderr(&stderr), cmdkit.WithArgs([]string{"bench", "--timings=[p50,p99]"}))
+	if err != nil {
+		t.Fatalf("Should have ran command declaring its own timings flag: %v", err)
+	}
+	if !reflect.DeepEqual(timings, []string{"p50", "p99"}) || stderr.Len() != 0 {
+		t.Fatalf("Should have used declared flag in place of built-in timings flag: %v %q", timings, stderr.String())
+	}
+}
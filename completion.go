@@ -0,0 +1,196 @@
+package cmdkit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// BashCompletion writes a bash completion script for the program of
+// giving title to w, completing the sub commands and flags of each
+// command and the choices of flags declared with OneOf or EnumFlag.
+// The script is loaded with `source <(program completion)` or by
+// placing it in the bash completion directory.
+func BashCompletion(title string, flags []Flag, cmds []Command, w io.Writer) error {
+	title = strings.ToLower(title)
+
+	var words, values strings.Builder
+	writeFlagChoices(&values, "", flags)
+
+	var roots []string
+	for _, cmd := range cmds {
+		roots = append(roots, cmd.Name)
+	}
+	fmt.Fprintf(&words, "\t\t%q) words=%q ;;\n", "", completionWords(roots, flags))
+
+	err := Walk(cmds, func(path []string, cmd Command) error {
+		subs := make([]string, 0, len(cmd.Commands))
+		for name := range cmd.Commands {
+			subs = append(subs, name)
+		}
+
+		key := strings.Join(path, ".")
+		fmt.Fprintf(&words, "\t\t%q) words=%q ;;\n", key, completionWords(subs, cmd.Flags))
+		writeFlagChoices(&values, key, cmd.Flags)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	name := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(title) + "_completions"
+	_, err = fmt.Fprintf(w, bashCompletionTml, name, values.String(), words.String(), name, title)
+	return err
+}
+
+// completionWords returns the space separated names of giving commands
+// and flags offered by the completion of a command, in order.
+func completionWords(cmds []string, flags []Flag) string {
+	words := make([]string, 0, len(cmds)+len(flags))
+	words = append(words, cmds...)
+	sort.Strings(words)
+	for _, flag := range flags {
+		words = append(words, "--"+strings.ToLower(flag.FlagName()))
+	}
+	return strings.Join(words, " ")
+}
+
+// writeFlagChoices writes a case of the completion script offering the
+// choices of each flag with choices of the command at giving path.
+func writeFlagChoices(bu *strings.Builder, path string, flags []Flag) {
+	for _, flag := range flags {
+		if len(flag.Choices) == 0 {
+			continue
+		}
+		key := path + ":--" + strings.ToLower(flag.FlagName())
+		fmt.Fprintf(bu, "\t\t%q) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", key, strings.Join(flag.Choices, " "))
+	}
+}
+
+// bashCompletionTml is the bash completion script, where the path of a
+// command is made of the words before the cursor which are neither
+// flags nor flag values, as in "config.set".
+const bashCompletionTml = `%s() {
+	local cur prev path word words skip=0
+	cur="${COMP_WORDS[COMP_CWORD]}"
+	prev="${COMP_WORDS[COMP_CWORD-1]}"
+	if [[ "$cur" == "=" ]]; then
+		cur=""
+	elif [[ "$prev" == "=" ]]; then
+		prev="${COMP_WORDS[COMP_CWORD-2]}"
+	fi
+
+	path=""
+	for word in "${COMP_WORDS[@]:1:COMP_CWORD-1}"; do
+		if [[ $skip == 1 ]]; then
+			skip=0
+			continue
+		fi
+		case "$word" in
+			=) skip=1 ;;
+			-*) ;;
+			*) path="${path:+$path.}$word" ;;
+		esac
+	done
+
+	case "$path:$prev" in
+%s	esac
+
+	case "$path" in
+%s		*) return ;;
+	esac
+	COMPREPLY=($(compgen -W "$words" -- "$cur"))
+}
+
+complete -F %s %s
+`
+
+// ErrStaleCompletionCache is returned when reading a completion cache
+// written for a different command tree than the current one.
+var ErrStaleCompletionCache = errors.New("completion cache is stale")
+
+// completionCacheHeader starts the first line of a completion cache,
+// followed by the fingerprint of the command tree of the cached script.
+const completionCacheHeader = "# cmdkit completion cache "
+
+// completionFingerprint returns a checksum of what the completion script
+// of the program is made of, being the names of its commands and flags
+// and the choices of flags, without generating the script.
+func completionFingerprint(title string, flags []Flag, cmds []Command) (string, error) {
+	sum := sha256.New()
+	io.WriteString(sum, bashCompletionTml)
+	fmt.Fprintf(sum, "%s\n", strings.ToLower(title))
+
+	writeFlags := func(path string, flags []Flag) {
+		for _, flag := range flags {
+			fmt.Fprintf(sum, "%s --%s %s\n", path, strings.ToLower(flag.FlagName()), strings.Join(flag.Choices, " "))
+		}
+	}
+	writeFlags("", flags)
+
+	err := Walk(cmds, func(path []string, cmd Command) error {
+		key := strings.Join(path, ".")
+		fmt.Fprintf(sum, "%s\n", key)
+		writeFlags(key, cmd.Flags)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// WriteCompletionCache writes the bash completion script of the program
+// to the file at giving path, for completion setups to source instead
+// of invoking the program, along with a fingerprint of the command tree
+// such that ReadCompletionCache detects when it changed.
+func WriteCompletionCache(path string, title string, flags []Flag, cmds []Command) error {
+	var script bytes.Buffer
+	if err := BashCompletion(title, flags, cmds, &script); err != nil {
+		return err
+	}
+
+	fingerprint, err := completionFingerprint(title, flags, cmds)
+	if err != nil {
+		return err
+	}
+	cache := completionCacheHeader + fingerprint + "\n" + script.String()
+
+	// the cache is replaced at once, as shells may source it at any time.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(cache), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadCompletionCache returns the completion script cached in the file
+// at giving path, returning ErrStaleCompletionCache if it was written
+// for a different command tree, in which case it should be written again.
+// The script is returned as cached, without generating it again.
+func ReadCompletionCache(path string, title string, flags []Flag, cmds []Command) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	header, script, ok := strings.Cut(string(data), "\n")
+	if !ok || !strings.HasPrefix(header, completionCacheHeader) {
+		return "", fmt.Errorf("%s is not a completion cache", path)
+	}
+
+	fingerprint, err := completionFingerprint(title, flags, cmds)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimPrefix(header, completionCacheHeader) != fingerprint {
+		return "", ErrStaleCompletionCache
+	}
+	return script, nil
+}
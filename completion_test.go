@@ -0,0 +1,112 @@
+package cmdkit_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gokit/cmdkit"
+)
+
+func TestBashCompletion(t *testing.T) {
+	deploy := cmdkit.Cmd("deploy")
+	deploy.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("env"), cmdkit.OneOf("dev", "staging", "prod")),
+		cmdkit.BoolFlag(cmdkit.FlagName("force")),
+	)
+	flags := cmdkit.Flags(
+		cmdkit.EnumFlag(map[string]interface{}{"debug": 0, "info": 1}, cmdkit.FlagName("level")),
+	)
+	cmds := cmdkit.Commands(deploy, cmdkit.Cmd("config", cmdkit.SubCommands(cmdkit.Cmd("set"))))
+
+	var out bytes.Buffer
+	if err := cmdkit.BashCompletion("example", flags, cmds, &out); err != nil {
+		t.Fatalf("Should have successfully written completion: %v", err)
+	}
+
+	script := out.String()
+	for _, expected := range []string{
+		`"deploy:--env") COMPREPLY=($(compgen -W "dev staging prod" -- "$cur")); return ;;`,
+		`":--level") COMPREPLY=($(compgen -W "debug info" -- "$cur")); return ;;`,
+		`"") words="config deploy --level" ;;`,
+		`"deploy") words="--env --force" ;;`,
+		`"config") words="set" ;;`,
+		`complete -F _example_completions example`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Fatalf("Should have written %s in completion: %s", expected, script)
+		}
+	}
+}
+
+func TestOneOf(t *testing.T) {
+	deploy := cmdkit.Cmd("deploy", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+	deploy.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("env"), cmdkit.OneOf("dev", "prod")))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"deploy", "--env=prod"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command with allowed value: %v", err)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"deploy", "--env=qa"}))
+	if err == nil || err.Error() != `flag "env": "qa" is not one of dev, prod` {
+		t.Fatalf("Should have failed with value not in choices: %v", err)
+	}
+}
+
+func TestCompletionCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.bash")
+	cmds := cmdkit.Commands(
+		cmdkit.Cmd("deploy"),
+		cmdkit.Cmd("config", cmdkit.SubCommands(cmdkit.Cmd("set"))),
+	)
+
+	if err := cmdkit.WriteCompletionCache(path, "example", nil, cmds); err != nil {
+		t.Fatalf("Should have successfully written cache: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Should have read cache file: %v", err)
+	}
+	for _, name := range []string{"deploy", "config", "set"} {
+		if !strings.Contains(string(data), name) {
+			t.Fatalf("Should have cached command %q: %s", name, data)
+		}
+	}
+
+	script, err := cmdkit.ReadCompletionCache(path, "example", nil, cmds)
+	if err != nil {
+		t.Fatalf("Should have successfully reloaded cache: %v", err)
+	}
+	var expected bytes.Buffer
+	if err := cmdkit.BashCompletion("example", nil, cmds, &expected); err != nil {
+		t.Fatalf("Should have successfully written completion: %v", err)
+	}
+	if script != expected.String() {
+		t.Fatalf("Should have reloaded cached script: %s", script)
+	}
+
+	// the cached script is returned as is, without generating it again.
+	header, _, _ := strings.Cut(string(data), "\n")
+	if err := os.WriteFile(path, []byte(header+"\ncached script\n"), 0644); err != nil {
+		t.Fatalf("Should have rewritten cache file: %v", err)
+	}
+	if script, err := cmdkit.ReadCompletionCache(path, "example", nil, cmds); err != nil || script != "cached script\n" {
+		t.Fatalf("Should have returned cached script: %q %v", script, err)
+	}
+
+	flags := cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("env"), cmdkit.OneOf("dev", "prod")))
+	if _, err := cmdkit.ReadCompletionCache(path, "example", flags, cmds); err != cmdkit.ErrStaleCompletionCache {
+		t.Fatalf("Should have invalidated cache of changed flags: %v", err)
+	}
+
+	cmds = append(cmds, cmdkit.Cmd("status"))
+	if _, err := cmdkit.ReadCompletionCache(path, "example", nil, cmds); err != cmdkit.ErrStaleCompletionCache {
+		t.Fatalf("Should have invalidated cache of changed commands: %v", err)
+	}
+}
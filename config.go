@@ -0,0 +1,279 @@
+package cmdkit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigTemplate returns a commented yaml configuration containing all
+// giving flags and the flags of giving commands and their sub commands
+// with their default values and descriptions. Flags without a default
+// value are written commented out.
+func ConfigTemplate(title string, flags []Flag, cmds []Command) string {
+	var bu bytes.Buffer
+	fmt.Fprintf(&bu, "# Configuration for %s.\n", strings.ToLower(title))
+	writeConfigFlags(&bu, "", flags)
+
+	for _, cmd := range cmds {
+		writeConfigCommand(&bu, "", cmd)
+	}
+	return bu.String()
+}
+
+func writeConfigCommand(bu *bytes.Buffer, indent string, cmd Command) {
+	fmt.Fprintf(bu, "\n%s%s:\n", indent, cmd.Name)
+	writeConfigFlags(bu, indent+"  ", cmd.Flags)
+
+	names := make([]string, 0, len(cmd.Commands))
+	for name := range cmd.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		writeConfigCommand(bu, indent+"  ", cmd.Commands[name])
+	}
+}
+
+func writeConfigFlags(bu *bytes.Buffer, indent string, flags []Flag) {
+	for _, flag := range flags {
+		bu.WriteString("\n")
+		if flag.Desc != "" {
+			fmt.Fprintf(bu, "%s# %s\n", indent, flag.Desc)
+		}
+		fmt.Fprintf(bu, "%s# type: %s\n", indent, flag.TypeString())
+
+		if flag.DefaultValue() == nil {
+			fmt.Fprintf(bu, "%s# %s:\n", indent, flag.FlagName())
+			continue
+		}
+		fmt.Fprintf(bu, "%s%s: %s\n", indent, flag.FlagName(), configValue(flag.DefaultValue()))
+	}
+}
+
+// configValue returns the yaml representation of giving value.
+func configValue(value interface{}) string {
+	switch item := value.(type) {
+	case string:
+		return strconv.Quote(item)
+	case time.Duration:
+		return strconv.Quote(item.String())
+	}
+
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Slice {
+		items := make([]string, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			items = append(items, configValue(rv.Index(i).Interface()))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return fmt.Sprint(value)
+}
+
+// loadConfigFiles reads giving yaml configuration files in order, with
+// the values of later files overriding those of earlier ones. Missing
+// files are skipped when optional is true.
+func loadConfigFiles(paths []string, optional bool) (map[string]interface{}, error) {
+	config := map[string]interface{}{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil && optional && os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config: %s", err)
+		}
+
+		values, err := parseConfig(data)
+		if err != nil {
+			return nil, fmt.Errorf("config %s: %s", path, err)
+		}
+		mergeConfig(config, values)
+	}
+	return config, nil
+}
+
+// mergeConfig copies the values of src into dst, merging nested
+// mappings present in both.
+func mergeConfig(dst map[string]interface{}, src map[string]interface{}) {
+	for key, value := range src {
+		from, ok := value.(map[string]interface{})
+		if !ok {
+			dst[key] = value
+			continue
+		}
+		if into, ok := dst[key].(map[string]interface{}); ok {
+			mergeConfig(into, from)
+			continue
+		}
+		dst[key] = from
+	}
+}
+
+// lookupConfig returns the values of giving flag name within the
+// mapping of the command at giving path of configuration.
+func lookupConfig(config map[string]interface{}, path []string, name string) ([]string, bool) {
+	for _, cmd := range path {
+		next, ok := config[cmd].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		config = next
+	}
+
+	switch value := config[name].(type) {
+	case string:
+		return []string{value}, true
+	case []string:
+		return value, len(value) != 0
+	}
+	return nil, false
+}
+
+// parseConfig parses the subset of yaml written by ConfigTemplate, being
+// mappings nested by space indentation holding scalar or inline list
+// values, with comments starting with a `#`.
+func parseConfig(data []byte) (map[string]interface{}, error) {
+	type level struct {
+		indent int
+		values map[string]interface{}
+	}
+
+	root := map[string]interface{}{}
+	stack := []level{{indent: -1, values: root}}
+
+	for index, line := range strings.Split(string(data), "\n") {
+		content := strings.TrimSpace(line)
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		for indent <= stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		pos := strings.Index(content, ":")
+		if pos < 1 {
+			return nil, fmt.Errorf("line %d: expected a key followed by a colon", index+1)
+		}
+
+		key := strings.TrimSpace(content[:pos])
+		raw := strings.TrimSpace(content[pos+1:])
+		values := stack[len(stack)-1].values
+
+		if raw == "" || strings.HasPrefix(raw, "#") {
+			child := map[string]interface{}{}
+			values[key] = child
+			stack = append(stack, level{indent: indent, values: child})
+			continue
+		}
+
+		value, err := parseConfigValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", index+1, err)
+		}
+		values[key] = value
+	}
+	return root, nil
+}
+
+// parseConfigValue parses a scalar or inline list value of a
+// configuration line.
+func parseConfigValue(raw string) (interface{}, error) {
+	if !strings.HasPrefix(raw, "[") {
+		return parseConfigScalar(raw)
+	}
+
+	end := strings.LastIndex(raw, "]")
+	if end == -1 {
+		return nil, fmt.Errorf("unterminated list %s", raw)
+	}
+
+	items := []string{}
+	for _, item := range splitConfigList(raw[1:end]) {
+		value, err := parseConfigScalar(item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+	}
+	return items, nil
+}
+
+// parseConfigScalar returns the value of a plain or double quoted
+// scalar, without any trailing comment.
+func parseConfigScalar(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, `"`) {
+		if pos := strings.Index(raw, " #"); pos != -1 {
+			raw = raw[:pos]
+		}
+		return strings.TrimSpace(raw), nil
+	}
+
+	quoted, err := strconv.QuotedPrefix(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid quoted value %s", raw)
+	}
+	return strconv.Unquote(quoted)
+}
+
+// splitConfigList splits the items of an inline list on commas outside
+// of quoted values.
+func splitConfigList(list string) []string {
+	var items []string
+	var quoted, escaped bool
+	start := 0
+	for i, ch := range list {
+		switch {
+		case escaped:
+			escaped = false
+		case ch == '\\' && quoted:
+			escaped = true
+		case ch == '"':
+			quoted = !quoted
+		case ch == ',' && !quoted:
+			items = append(items, list[start:i])
+			start = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(list[start:]); rest != "" || len(items) != 0 {
+		items = append(items, list[start:])
+	}
+	return items
+}
+
+// configCommand returns the built-in config command which provides
+// the init sub command writing the configuration template of giving
+// flags and commands to the standard output.
+func configCommand(title string, flags []Flag, cmds []Command) Command {
+	tml := ConfigTemplate(title, flags, cmds)
+
+	initCmd := Cmd(
+		"init",
+		ShortDesc("Prints a configuration template with all flags"),
+		Desc("Prints a commented yaml configuration containing every flag with its default value and description."),
+		WithAction(func(ctx Context) error {
+			ctx.Printf("%s", tml)
+			return nil
+		}),
+	)
+
+	return Cmd(
+		"config",
+		ShortDesc("Manages the configuration of the program"),
+		Desc("Manages the configuration of the program."),
+		WithAction(func(ctx Context) error {
+			ctx.PrintHelp()
+			return nil
+		}),
+		SubCommands(initCmd),
+	)
+}
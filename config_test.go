@@ -0,0 +1,150 @@
+package cmdkit_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gokit/cmdkit"
+)
+
+func TestConfigInit(t *testing.T) {
+	add := cmdkit.Cmd("add")
+	add.Flags = cmdkit.Flags(cmdkit.StringFlag(cmdkit.FlagName("name"), cmdkit.FlagDesc("name of user")))
+
+	var out bytes.Buffer
+	cmdkit.Run("example", cmdkit.Flags(
+		cmdkit.IntFlag(cmdkit.FlagName("age"), cmdkit.Default(20), cmdkit.FlagDesc("age of user")),
+	), cmdkit.Commands(add), cmdkit.WithConfigCommand(), cmdkit.WithStdout(&out), cmdkit.WithArgs([]string{"config", "init"}))
+
+	config := out.String()
+	if !strings.Contains(config, "# age of user\n# type: int\nage: 20\n") {
+		t.Fatalf("Should contain flag with default: %q", config)
+	}
+	if !strings.Contains(config, "add:\n\n  # name of user\n  # type: string\n  # name:\n") {
+		t.Fatalf("Should contain command flag without default: %q", config)
+	}
+}
+
+func TestConfigCommandOptIn(t *testing.T) {
+	var out bytes.Buffer
+	err := cmdkit.RunWithError("example", nil, cmdkit.Commands(cmdkit.Cmd("add")),
+		cmdkit.WithStdout(&out), cmdkit.WithArgs([]string{"config", "init"}))
+	if err == nil || !strings.Contains(err.Error(), `command not found "config"`) {
+		t.Fatalf("Should not add config command without WithConfigCommand: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("Should not have printed a config template: %q", out.String())
+	}
+}
+
+func writeConfig(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Should have written config file: %v", err)
+	}
+	return path
+}
+
+func TestConfigFilesLayering(t *testing.T) {
+	base := writeConfig(t, "base.yaml", `# Configuration for example.
+name: "base"
+replicas: 2
+
+deploy:
+  # region to deploy into
+  region: "us-east-1"
+  tags: ["web", "api"]
+`)
+	override := writeConfig(t, "override.yaml", `name: override
+deploy:
+  region: "eu-west-1" # closer to users
+`)
+
+	var name, region string
+	var replicas int
+	var tags []string
+	deploy := cmdkit.Cmd("deploy", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		name = ctx.String("name")
+		replicas = ctx.Int("replicas")
+		region = ctx.String("region")
+		value, _ := ctx.Get("tags")
+		tags = value.([]string)
+		return nil
+	}))
+	deploy.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("region"), cmdkit.Default("local")),
+		cmdkit.StringListFlag(cmdkit.FlagName("tags")),
+	)
+	flags := cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("name")),
+		cmdkit.IntFlag(cmdkit.FlagName("replicas"), cmdkit.Default(1)),
+	)
+
+	err := cmdkit.RunErr("example", flags, cmdkit.Commands(deploy), cmdkit.WithConfigFiles(base, override), cmdkit.WithArgs([]string{"deploy"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if name != "override" || replicas != 2 || region != "eu-west-1" {
+		t.Fatalf("Should have layered config files: name=%q replicas=%d region=%q", name, replicas, region)
+	}
+	if !reflect.DeepEqual(tags, []string{"web", "api"}) {
+		t.Fatalf("Should have read list from config: %#v", tags)
+	}
+
+	err = cmdkit.RunErr("example", flags, cmdkit.Commands(deploy), cmdkit.WithConfigFiles(base, override), cmdkit.WithArgs([]string{"--name=flag", "deploy", "--region=ap"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if name != "flag" || region != "ap" {
+		t.Fatalf("Should have preferred flags over config: name=%q region=%q", name, region)
+	}
+}
+
+func TestOptionalConfigFiles(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	noop := cmdkit.Cmd("noop", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(noop), cmdkit.WithConfigFiles(missing), cmdkit.WithArgs([]string{"noop"}))
+	if err == nil {
+		t.Fatal("Should have failed with missing config file")
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(noop), cmdkit.WithConfigFiles(missing), cmdkit.WithOptionalConfig(), cmdkit.WithArgs([]string{"noop"}))
+	if err != nil {
+		t.Fatalf("Should have skipped missing config file: %v", err)
+	}
+}
+
+func TestConfigTemplateLoads(t *testing.T) {
+	add := cmdkit.Cmd("add", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return nil
+	}))
+	add.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("name"), cmdkit.Default("wallet: \"main\"")),
+		cmdkit.DurationFlag(cmdkit.FlagName("wait"), cmdkit.Default(time.Second)),
+		cmdkit.StringListFlag(cmdkit.FlagName("tags"), cmdkit.Default([]string{"a, b", "c"})),
+	)
+	flags := cmdkit.Flags(cmdkit.IntFlag(cmdkit.FlagName("age"), cmdkit.Default(20)))
+
+	path := writeConfig(t, "config.yaml", cmdkit.ConfigTemplate("example", flags, cmdkit.Commands(add)))
+
+	var observed = map[string]string{}
+	err := cmdkit.RunErr("example", flags, cmdkit.Commands(add), cmdkit.WithConfigFiles(path), cmdkit.WithFlagObserver(func(name string, value interface{}, source string) {
+		observed[name] = source
+	}), cmdkit.WithArgs([]string{"add"}))
+	if err != nil {
+		t.Fatalf("Should have loaded generated template: %v", err)
+	}
+	for _, name := range []string{"age", "name", "wait", "tags"} {
+		if observed[name] != cmdkit.SourceConfig {
+			t.Fatalf("Should have resolved %q from config: %q", name, observed[name])
+		}
+	}
+}
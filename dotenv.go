@@ -0,0 +1,98 @@
+package cmdkit
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// WithDotEnv returns a RunOption which reads environment variables from
+// giving .env file of KEY=VALUE lines, such that flags with an Env name
+// resolve from it. Variables of the process environment take precedence
+// over those of the file, unless WithDotEnvOverride is used. Multiple
+// files are applied in order with later files overriding earlier ones.
+func WithDotEnv(path string) RunOption {
+	return func(rc *runConfig) {
+		rc.dotEnvFiles = append(rc.dotEnvFiles, path)
+	}
+}
+
+// WithDotEnvOverride returns a RunOption which makes the variables read
+// from .env files take precedence over those of the process environment.
+func WithDotEnvOverride() RunOption {
+	return func(rc *runConfig) {
+		rc.dotEnvOverride = true
+	}
+}
+
+// lookupEnv returns the value of the environment variable named by the
+// key from the process environment or the loaded .env files.
+func (rc *runConfig) lookupEnv(key string) (string, bool) {
+	if value, ok := rc.dotEnv[key]; ok && rc.dotEnvOverride {
+		return value, true
+	}
+	if value, ok := os.LookupEnv(key); ok {
+		return value, true
+	}
+	value, ok := rc.dotEnv[key]
+	return value, ok
+}
+
+// loadDotEnvFiles reads giving .env files in order, with the variables
+// of later files overriding those of earlier ones.
+func loadDotEnvFiles(paths []string) (map[string]string, error) {
+	env := map[string]string{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read env file: %s", err)
+		}
+		if err := parseDotEnv(string(data), env); err != nil {
+			return nil, fmt.Errorf("env file %s: %s", path, err)
+		}
+	}
+	return env, nil
+}
+
+// parseDotEnv reads the KEY=VALUE lines of giving .env content into env,
+// skipping blank lines and comments. Values may be wrapped in single
+// quotes, kept as is, or double quotes, which support escapes such as
+// \n, while unquoted values end at a ` #` comment.
+func parseDotEnv(content string, env map[string]string) error {
+	for index, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("line %d: expected KEY=VALUE, got %q", index+1, line)
+		}
+
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) > 1 && value[0] == '"':
+			end := strings.LastIndex(value, "\"")
+			unquoted, err := strconv.Unquote(value[:end+1])
+			if end == 0 || err != nil {
+				return fmt.Errorf("line %d: invalid quoted value of %s", index+1, key)
+			}
+			value = unquoted
+		case len(value) > 1 && value[0] == '\'':
+			end := strings.LastIndex(value, "'")
+			if end == 0 {
+				return fmt.Errorf("line %d: invalid quoted value of %s", index+1, key)
+			}
+			value = value[1:end]
+		default:
+			if comment := strings.Index(value, " #"); comment != -1 {
+				value = strings.TrimSpace(value[:comment])
+			}
+		}
+		env[key] = value
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package cmdkit_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gokit/cmdkit"
+)
+
+func TestDotEnvFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	content := "# deployment settings\nexport DEPLOY_REGION=eu-west-1\nDEPLOY_TOKEN=\"s3cr3t \\\"quoted\\\"\"\nDEPLOY_NOTE='keep # this' \nDEPLOY_MODE=fast # inline comment\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var region, token, note, mode string
+	deploy := cmdkit.Cmd("deploy", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		region, token = ctx.String("region"), ctx.String("token")
+		note, mode = ctx.String("note"), ctx.String("mode")
+		return nil
+	}))
+	deploy.Flags = cmdkit.Flags(
+		cmdkit.StringFlag(cmdkit.FlagName("region"), cmdkit.Env("DEPLOY_REGION")),
+		cmdkit.StringFlag(cmdkit.FlagName("token"), cmdkit.Env("DEPLOY_TOKEN")),
+		cmdkit.StringFlag(cmdkit.FlagName("note"), cmdkit.Env("DEPLOY_NOTE")),
+		cmdkit.StringFlag(cmdkit.FlagName("mode"), cmdkit.Env("DEPLOY_MODE")),
+	)
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithDotEnv(path), cmdkit.WithArgs([]string{"deploy"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if region != "eu-west-1" || token != `s3cr3t "quoted"` || note != "keep # this" || mode != "fast" {
+		t.Fatalf("Should have resolved flags from env file: %q %q %q %q", region, token, note, mode)
+	}
+
+	t.Setenv("DEPLOY_REGION", "us-east-1")
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithDotEnv(path), cmdkit.WithArgs([]string{"deploy"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if region != "us-east-1" {
+		t.Fatalf("Should have preferred process environment over env file: %q", region)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithDotEnv(path), cmdkit.WithDotEnvOverride(), cmdkit.WithArgs([]string{"deploy"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if region != "eu-west-1" {
+		t.Fatalf("Should have preferred env file when overriding: %q", region)
+	}
+}
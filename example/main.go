@@ -1,6 +1,5 @@
 package main
 
-import "fmt"
 import "github.com/gokit/cmdkit"
 
 func main() {
@@ -12,7 +11,7 @@ func main() {
 			"add",
 			cmdkit.Desc("displays a add message"),
 			cmdkit.WithAction(func(ctx cmdkit.Context) error {
-				fmt.Printf("Welcome to add: %q -> %d \n", ctx.String("name"), ctx.Int("age"))
+				ctx.Printf("Welcome to add: %q -> %d \n", ctx.String("name"), ctx.Int("age"))
 				return nil
 			}),
 			cmdkit.SubCommands(
@@ -20,7 +19,7 @@ func main() {
 					"broc",
 					cmdkit.Desc("displays a broc message"),
 					cmdkit.WithAction(func(ctx cmdkit.Context) error {
-						fmt.Printf("Welcome to bro adder: %q -> %d \n", ctx.String("name"), ctx.Int("age"))
+						ctx.Printf("Welcome to bro adder: %q -> %d \n", ctx.String("name"), ctx.Int("age"))
 						return nil
 					}),
 				),
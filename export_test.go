@@ -0,0 +1,12 @@
+package cmdkit
+
+import "os"
+
+// WithSignals returns a RunOption which delivers the signals sent on
+// giving channel to the run in place of those of the process, such that
+// tests don't signal the whole test binary.
+func WithSignals(signals <-chan os.Signal) RunOption {
+	return func(rc *runConfig) {
+		rc.signals = signals
+	}
+}
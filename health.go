@@ -0,0 +1,40 @@
+package cmdkit
+
+import (
+	"fmt"
+	"sort"
+)
+
+// HealthCommand returns a health command which runs each of giving named
+// checks in order of their names, writing whether each passed or failed
+// to the standard output, and failing if any of the checks failed.
+func HealthCommand(checks map[string]func() error) Command {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return Cmd(
+		"health",
+		ShortDesc("Runs the health checks of the program"),
+		Desc("Runs every health check of the program, reporting which passed and failed."),
+		WithAction(func(ctx Context) error {
+			var failed int
+			for _, name := range names {
+				if err := checks[name](); err != nil {
+					failed++
+					ctx.Printf("FAIL  %s: %s\n", name, err)
+					continue
+				}
+				ctx.Printf("PASS  %s\n", name)
+			}
+
+			ctx.Printf("%d of %d checks passed\n", len(names)-failed, len(names))
+			if failed != 0 {
+				return fmt.Errorf("%d of %d health checks failed", failed, len(names))
+			}
+			return nil
+		}),
+	)
+}
@@ -0,0 +1,37 @@
+package cmdkit_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/gokit/cmdkit"
+)
+
+func TestHealthCommand(t *testing.T) {
+	var out, errOut bytes.Buffer
+	var code int
+	health := cmdkit.HealthCommand(map[string]func() error{
+		"database": func() error {
+			return nil
+		},
+		"cache": func() error {
+			return errors.New("connection refused")
+		},
+	})
+
+	cmdkit.Run("example", nil, cmdkit.Commands(health), cmdkit.WithStdout(&out), cmdkit.WithStderr(&errOut), cmdkit.WithExit(func(c int) {
+		code = c
+	}), cmdkit.WithArgs([]string{"health"}))
+
+	if code != 1 {
+		t.Fatalf("Should have exited with non-zero code: %d", code)
+	}
+	expected := "FAIL  cache: connection refused\nPASS  database\n1 of 2 checks passed\n"
+	if out.String() != expected {
+		t.Fatalf("Should have written summary of checks: %q", out.String())
+	}
+	if errOut.String() != "1 of 2 health checks failed" {
+		t.Fatalf("Should have printed failure: %q", errOut.String())
+	}
+}
@@ -0,0 +1,101 @@
+package cmdkit
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrSecretNotFound is returned by a Keyring when it holds no secret for
+// the requested service and account.
+var ErrSecretNotFound = errors.New("secret not found in keyring")
+
+// ErrKeyringUnavailable is returned by a Keyring when the keyring of the
+// machine can't be used, such as when its command line tool is missing,
+// in which case flags resolve from their config or default instead.
+var ErrKeyringUnavailable = errors.New("keyring unavailable")
+
+// Keyring defines a interface which exposes the secrets stored in a
+// keyring by their service and account.
+type Keyring interface {
+	Get(service string, account string) (string, error)
+}
+
+// KeyringFlag creates a secret string flag which, when no value is
+// provided on the command line or through its environment variable,
+// reads its value from the keyring entry of giving service, using the
+// name of the flag as the account.
+func KeyringFlag(service string, ops ...FlagOption) Flag {
+	impl := StringFlag(ops...)
+	impl.Keyring = service
+	impl.Secret = true
+	return impl
+}
+
+// WithKeyring returns a RunOption which sets the Keyring the values of
+// flags created with KeyringFlag are read from, in place of the keyring
+// of the operating system. A nil Keyring disables reading from keyrings.
+func WithKeyring(keyring Keyring) RunOption {
+	return func(rc *runConfig) {
+		rc.keyring = keyring
+	}
+}
+
+// noopKeyring implements the Keyring interface without any keyring,
+// used when none is available.
+type noopKeyring struct{}
+
+// Get implements the Keyring interface.
+func (noopKeyring) Get(string, string) (string, error) {
+	return "", ErrKeyringUnavailable
+}
+
+// systemKeyring implements the Keyring interface using the command line
+// tools of the keyring of the operating system, the security tool on
+// macOS and secret-tool of libsecret elsewhere.
+type systemKeyring struct{}
+
+// Get implements the Keyring interface.
+func (systemKeyring) Get(service string, account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "windows":
+		return "", fmt.Errorf("%w: keyring of %s is not supported", ErrKeyringUnavailable, runtime.GOOS)
+	default:
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	}
+
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", fmt.Errorf("%w: %s", ErrKeyringUnavailable, err)
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if secretNotFound(exitErr) {
+			return "", ErrSecretNotFound
+		}
+		if msg := strings.TrimSpace(string(exitErr.Stderr)); msg != "" {
+			return "", fmt.Errorf("%s: %s", err, msg)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// secretNotFound returns true/false if giving exit of the keyring tool
+// reports a missing secret rather than a failure, being status 44 of
+// the security tool, and status 1 without any error message of
+// secret-tool, which reports failures such as a locked keyring.
+func secretNotFound(exitErr *exec.ExitError) bool {
+	if runtime.GOOS == "darwin" {
+		return exitErr.ExitCode() == 44
+	}
+	return exitErr.ExitCode() == 1 && len(strings.TrimSpace(string(exitErr.Stderr))) == 0
+}
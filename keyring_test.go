@@ -0,0 +1,113 @@
+package cmdkit_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gokit/cmdkit"
+)
+
+type fakeKeyring map[string]string
+
+func (f fakeKeyring) Get(service string, account string) (string, error) {
+	secret, ok := f[service+"/"+account]
+	if !ok {
+		return "", cmdkit.ErrSecretNotFound
+	}
+	return secret, nil
+}
+
+func TestKeyringFlag(t *testing.T) {
+	var token, source string
+	deploy := cmdkit.Cmd("deploy", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		token = ctx.String("token")
+		return nil
+	}))
+	deploy.Flags = cmdkit.Flags(
+		cmdkit.KeyringFlag("example", cmdkit.FlagName("token"), cmdkit.Default("none")),
+	)
+	keyring := fakeKeyring{"example/token": "s3cr3t"}
+	observer := cmdkit.WithFlagObserver(func(name string, value interface{}, src string) {
+		if name == "token" {
+			source = src
+		}
+	})
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithKeyring(keyring), observer, cmdkit.WithArgs([]string{"deploy"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if token != "s3cr3t" || source != cmdkit.SourceKeyring {
+		t.Fatalf("Should have read flag value from keyring: %q from %q", token, source)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithKeyring(keyring), cmdkit.WithArgs([]string{"deploy", "--token=override"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if token != "override" {
+		t.Fatalf("Should have preferred provided flag value over keyring: %q", token)
+	}
+
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithKeyring(fakeKeyring{}), cmdkit.WithArgs([]string{"deploy"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command: %v", err)
+	}
+	if token != "none" {
+		t.Fatalf("Should have used default without keyring entry: %q", token)
+	}
+
+	token = ""
+	err = cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithKeyring(nil), cmdkit.WithArgs([]string{"deploy"}))
+	if err != nil {
+		t.Fatalf("Should have successfully ran command without keyring: %v", err)
+	}
+	if token != "none" {
+		t.Fatalf("Should have used default without keyring: %q", token)
+	}
+}
+
+func TestSystemKeyringFallsBack(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("fake keyring tool is a secret-tool shell script")
+	}
+
+	var token string
+	deploy := cmdkit.Cmd("deploy", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		token = ctx.String("token")
+		return nil
+	}))
+	deploy.Flags = cmdkit.Flags(
+		cmdkit.KeyringFlag("example", cmdkit.FlagName("token"), cmdkit.Default("none")),
+	)
+
+	run := func(script string) error {
+		dir := t.TempDir()
+		if script != "" {
+			if err := os.WriteFile(filepath.Join(dir, "secret-tool"), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+				t.Fatalf("Should have written fake keyring tool: %v", err)
+			}
+		}
+		t.Setenv("PATH", dir)
+		token = ""
+		return cmdkit.RunErr("example", nil, cmdkit.Commands(deploy), cmdkit.WithArgs([]string{"deploy"}))
+	}
+
+	if err := run(""); err != nil || token != "none" {
+		t.Fatalf("Should have used default without keyring tool: %q %v", token, err)
+	}
+	if err := run("exit 1\n"); err != nil || token != "none" {
+		t.Fatalf("Should have used default without keyring entry: %q %v", token, err)
+	}
+	if err := run("echo s3cr3t\n"); err != nil || token != "s3cr3t" {
+		t.Fatalf("Should have read secret from keyring tool: %q %v", token, err)
+	}
+
+	err := run("echo 'Cannot autolaunch D-Bus' >&2\nexit 1\n")
+	if err == nil || !strings.Contains(err.Error(), "Cannot autolaunch D-Bus") {
+		t.Fatalf("Should have failed with keyring tool error: %v", err)
+	}
+}
@@ -0,0 +1,260 @@
+package cmdkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+)
+
+// lists of output formats of Context.Render.
+const (
+	FormatTable    = "table"
+	FormatJSON     = "json"
+	FormatYAML     = "yaml"
+	FormatTemplate = "template"
+)
+
+var (
+	formatFlag = StringFlag(FlagName("format"), FlagDesc("Output format: table, json, yaml or template"), Validate(func(value string, _ ...string) error {
+		switch value {
+		case FormatTable, FormatJSON, FormatYAML, FormatTemplate:
+			return nil
+		}
+		return fmt.Errorf("unknown output format %q, expected one of table, json, yaml or template", value)
+	}))
+	templateFlag = StringFlag(FlagName("template"), FlagDesc("Go template of the template output format"))
+)
+
+// WithFormatFlags returns a RunOption which adds the built-in --format
+// and --template flags to every command, selecting how Context.Render
+// writes values.
+func WithFormatFlags() RunOption {
+	return func(rc *runConfig) {
+		rc.formats = true
+	}
+}
+
+// Render writes giving value to the standard output of the command in
+// the format selected with the --format flag, a table by default, or
+// with the Go template of the --template flag for the template format.
+func (c *ctxImpl) Render(v interface{}) error {
+	switch format := c.String("format"); format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(c.Stdout(), "%s\n", data)
+		return err
+	case FormatYAML:
+		value, err := plainValue(v)
+		if err != nil {
+			return err
+		}
+		var out strings.Builder
+		writeYAML(&out, value, 0)
+		_, err = io.WriteString(c.Stdout(), out.String())
+		return err
+	case FormatTemplate:
+		if c.String("template") == "" {
+			return fmt.Errorf("template output format requires the --template flag")
+		}
+		tml, err := template.New("format").Parse(c.String("template"))
+		if err != nil {
+			return err
+		}
+		return tml.Execute(c.Stdout(), v)
+	case FormatTable, "":
+		value, err := plainValue(v)
+		if err != nil {
+			return err
+		}
+		return writeTable(c.Stdout(), value)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// plainValue returns giving value as made of maps, slices and scalars
+// by its JSON encoding, such that struct fields follow their json tags.
+func plainValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// writeTable writes giving value as a table, with a row for each item
+// of a list of objects and a column for each of their keys, or a row
+// for each key of an object.
+func writeTable(w io.Writer, value interface{}) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	switch value := value.(type) {
+	case []interface{}:
+		var columns []string
+		seen := map[string]bool{}
+		for _, item := range value {
+			row, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, key := range sortedKeys(row) {
+				if !seen[key] {
+					seen[key] = true
+					columns = append(columns, key)
+				}
+			}
+		}
+
+		if len(columns) != 0 {
+			fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t")))
+		}
+		for _, item := range value {
+			row, ok := item.(map[string]interface{})
+			if !ok {
+				fmt.Fprintln(tw, cellValue(item))
+				continue
+			}
+			cells := make([]string, len(columns))
+			for index, column := range columns {
+				cells[index] = cellValue(row[column])
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+	case map[string]interface{}:
+		for _, key := range sortedKeys(value) {
+			fmt.Fprintf(tw, "%s\t%s\n", strings.ToUpper(key), cellValue(value[key]))
+		}
+	default:
+		fmt.Fprintln(tw, cellValue(value))
+	}
+	return tw.Flush()
+}
+
+// cellValue returns giving value as the text of a table cell, where
+// lists and objects are written as JSON.
+func cellValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []interface{}, map[string]interface{}:
+		data, _ := json.Marshal(value)
+		return string(data)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// writeYAML writes giving value as YAML indented by giving depth.
+func writeYAML(out *strings.Builder, value interface{}, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if len(value) == 0 {
+			out.WriteString(indent + "{}\n")
+			return
+		}
+		for _, key := range sortedKeys(value) {
+			switch item := value[key].(type) {
+			case map[string]interface{}, []interface{}:
+				if isEmptyYAML(item) {
+					fmt.Fprintf(out, "%s%s: %s", indent, yamlScalar(key), emptyYAML(item))
+					continue
+				}
+				fmt.Fprintf(out, "%s%s:\n", indent, yamlScalar(key))
+				writeYAML(out, item, depth+1)
+			default:
+				fmt.Fprintf(out, "%s%s: %s\n", indent, yamlScalar(key), yamlScalar(item))
+			}
+		}
+	case []interface{}:
+		if len(value) == 0 {
+			out.WriteString(indent + "[]\n")
+			return
+		}
+		for _, item := range value {
+			switch item := item.(type) {
+			case map[string]interface{}, []interface{}:
+				if isEmptyYAML(item) {
+					fmt.Fprintf(out, "%s- %s", indent, emptyYAML(item))
+					continue
+				}
+				// the first line of a nested value follows the dash.
+				var nested strings.Builder
+				writeYAML(&nested, item, depth+1)
+				fmt.Fprintf(out, "%s- %s", indent, strings.TrimPrefix(nested.String(), indent+"  "))
+			default:
+				fmt.Fprintf(out, "%s- %s\n", indent, yamlScalar(item))
+			}
+		}
+	default:
+		fmt.Fprintf(out, "%s%s\n", indent, yamlScalar(value))
+	}
+}
+
+// isEmptyYAML returns true/false if giving list or object has no items.
+func isEmptyYAML(value interface{}) bool {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return len(value) == 0
+	case []interface{}:
+		return len(value) == 0
+	}
+	return false
+}
+
+// emptyYAML returns the flow notation of giving empty list or object.
+func emptyYAML(value interface{}) string {
+	if _, ok := value.([]interface{}); ok {
+		return "[]\n"
+	}
+	return "{}\n"
+}
+
+// yamlScalar returns giving scalar value as YAML, quoting strings which
+// would otherwise be read as another type or break the document.
+func yamlScalar(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		if value == "" || value != strings.TrimSpace(value) || strings.ContainsAny(value, ":#\n\"'{}[],&*!|>%@`") ||
+			strings.HasPrefix(value, "-") || strings.HasPrefix(value, "?") {
+			return strconv.Quote(value)
+		}
+		switch strings.ToLower(value) {
+		case "true", "false", "yes", "no", "on", "off", "null", "~":
+			return strconv.Quote(value)
+		}
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return strconv.Quote(value)
+		}
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// sortedKeys returns the keys of giving object in order.
+func sortedKeys(value map[string]interface{}) []string {
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
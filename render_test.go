@@ -0,0 +1,72 @@
+package cmdkit_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gokit/cmdkit"
+)
+
+type release struct {
+	Name    string   `json:"name"`
+	Version string   `json:"version"`
+	Tags    []string `json:"tags"`
+}
+
+func renderRelease(t *testing.T, args ...string) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	show := cmdkit.Cmd("show", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return ctx.Render([]release{{Name: "cmdkit", Version: "1.2.0", Tags: []string{"cli", "go"}}})
+	}))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(show), cmdkit.WithFormatFlags(), cmdkit.WithStdout(&out), cmdkit.WithArgs(append([]string{"show"}, args...)))
+	if err != nil {
+		t.Fatalf("Should have successfully rendered value: %v", err)
+	}
+	return out.String()
+}
+
+func TestRenderJSON(t *testing.T) {
+	expected := "[\n  {\n    \"name\": \"cmdkit\",\n    \"version\": \"1.2.0\",\n    \"tags\": [\n      \"cli\",\n      \"go\"\n    ]\n  }\n]\n"
+	if out := renderRelease(t, "--format=json"); out != expected {
+		t.Fatalf("Should have rendered value as json: %q", out)
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	var out bytes.Buffer
+	show := cmdkit.Cmd("show", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return ctx.Render(release{Name: "cmdkit", Version: "1.2.0"})
+	}))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(show), cmdkit.WithFormatFlags(), cmdkit.WithStdout(&out), cmdkit.WithArgs([]string{"show", "--format=template", "--template={{.Name}}@{{.Version}}"}))
+	if err != nil {
+		t.Fatalf("Should have successfully rendered value: %v", err)
+	}
+	if out.String() != "cmdkit@1.2.0" {
+		t.Fatalf("Should have rendered value with template: %q", out.String())
+	}
+}
+
+func TestRenderTableAndYAML(t *testing.T) {
+	if out := renderRelease(t); out != "NAME    TAGS          VERSION\ncmdkit  [\"cli\",\"go\"]  1.2.0\n" {
+		t.Fatalf("Should have rendered value as table by default: %q", out)
+	}
+
+	if out := renderRelease(t, "--format=yaml"); out != "- name: cmdkit\n  tags:\n    - cli\n    - go\n  version: 1.2.0\n" {
+		t.Fatalf("Should have rendered value as yaml: %q", out)
+	}
+}
+
+func TestRenderUnknownFormat(t *testing.T) {
+	show := cmdkit.Cmd("show", cmdkit.WithAction(func(ctx cmdkit.Context) error {
+		return ctx.Render("value")
+	}))
+
+	err := cmdkit.RunErr("example", nil, cmdkit.Commands(show), cmdkit.WithFormatFlags(), cmdkit.WithArgs([]string{"show", "--format=xml"}))
+	if err == nil {
+		t.Fatal("Should have failed with unknown output format")
+	}
+}
@@ -0,0 +1,5 @@
+package cmdkit
+
+import "syscall"
+
+const ioctlReadTermios = syscall.TCGETS
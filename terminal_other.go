@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+
+package cmdkit
+
+import "os"
+
+// isTerminal reports false, as terminals can't be detected on this
+// platform.
+func isTerminal(file *os.File) bool {
+	return false
+}
@@ -0,0 +1,18 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package cmdkit
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// isTerminal returns true/false if giving file is a terminal, by reading
+// its terminal attributes, which fails for files, pipes and devices such
+// as /dev/null.
+func isTerminal(file *os.File) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall6(syscall.SYS_IOCTL, file.Fd(), ioctlReadTermios, uintptr(unsafe.Pointer(&termios)), 0, 0, 0)
+	return errno == 0
+}
@@ -0,0 +1,13 @@
+package cmdkit
+
+import (
+	"os"
+	"syscall"
+)
+
+// isTerminal returns true/false if giving file is a console, which
+// fails for files, pipes and the NUL device.
+func isTerminal(file *os.File) bool {
+	var mode uint32
+	return syscall.GetConsoleMode(syscall.Handle(file.Fd()), &mode) == nil
+}